@@ -1,36 +1,140 @@
 package app
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
-
-	_ "github.com/lib/pq"
+	"log/slog"
+	"strconv"
+	"time"
 )
 
+// ErrInvalidID возвращается, если идентификатор не является целым числом.
+var ErrInvalidID = &Error{Kind: KindValidation, Code: "invalid_id", Message: "некорректный идентификатор"}
+
 type App struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect *dialect
+	// fuzzy — индекс опечаток для СУБД без pg_trgm
+	fuzzy  fuzzyCache
+	logger *slog.Logger
+}
+
+// Options — настройки подключения к базе данных. Нулевые значения пула
+// оставляют настройки database/sql по умолчанию.
+type Options struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// ConnectTimeout — сколько времени повторять попытки подключения при запуске,
+	// пока база данных недоступна; 0 — одна попытка
+	ConnectTimeout time.Duration
+	// Logger — журнал; nil — slog.Default()
+	Logger *slog.Logger
 }
 
-func NewApp(connStr string) *App {
+// Задержка между попытками подключения растёт вдвое от connectRetryMin до connectRetryMax.
+const (
+	connectRetryMin = 500 * time.Millisecond
+	connectRetryMax = 10 * time.Second
+)
+
+// NewApp подключается к базе данных. Отмена ctx прерывает повторные попытки подключения.
+func NewApp(ctx context.Context, connStr string, opts Options) (*App, error) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	// Определяем СУБД по схеме строки подключения
+	dialect, dsn, err := parseDSN(connStr)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора строки подключения: %v", err)
+	}
 
 	// Открываем соединение с базой данных
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open(dialect.driver, dsn)
 	if err != nil {
-		log.Fatal("Ошибка открытия соединения:", err)
+		return nil, fmt.Errorf("ошибка открытия соединения: %v", err)
+	}
+	if dialect == sqliteDialect {
+		// Одно соединение исключает ошибки SQLITE_BUSY при одновременной записи,
+		// поэтому настройки пула к SQLite не применяются
+		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+		if opts.MaxIdleConns > 0 {
+			db.SetMaxIdleConns(opts.MaxIdleConns)
+		}
+		db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+		db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
 	}
 
 	// Проверяем подключение к базе данных
-	err = db.Ping()
-	if err != nil {
-		log.Fatal("Не удалось подключиться к базе данных:", err)
+	if err := ping(ctx, logger, db, opts.ConnectTimeout); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("не удалось подключиться к базе данных: %v", err)
 	}
-	fmt.Println("Успешное подключение к базе данных PostgreSQL!")
+	logger.InfoContext(ctx, "подключение к базе данных установлено", "dbms", dialect.name)
 
 	app := App{
 
-		db: db,
+		db:      db,
+		dialect: dialect,
+		logger:  logger,
 	}
-	return &app
+	return &app, nil
 
 }
+
+// ping проверяет подключение к базе данных. Пока не истечёт timeout, неудачные
+// попытки повторяются с экспоненциально растущей задержкой: при совместном
+// запуске с базой данных в docker-compose она может стать доступной не сразу.
+func ping(ctx context.Context, logger *slog.Logger, db *sql.DB, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	delay := connectRetryMin
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 || ctx.Err() != nil {
+			return err
+		}
+		if delay > remaining {
+			delay = remaining
+		}
+		logger.WarnContext(ctx, "база данных недоступна, повтор подключения",
+			"attempt", attempt, "retry_in", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, connectRetryMax)
+	}
+}
+
+// Close закрывает соединения с базой данных.
+func (app *App) Close() error {
+	return app.db.Close()
+}
+
+// parseID разбирает идентификатор из строки заранее, чтобы некорректное значение
+// одинаково отвергалось любой СУБД.
+func parseID(id string) (int, error) {
+	i, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, ErrInvalidID.With("некорректный идентификатор %q", id)
+	}
+	return i, nil
+}
@@ -1,75 +1,309 @@
 package app
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"strings"
+)
+
+var (
+	ErrCategoryNotFound = &Error{Kind: KindNotFound, Code: "category_not_found", Message: "категория не найдена"}
+	ErrCategoryExists   = &Error{
+		Kind:    KindConflict,
+		Code:    "category_exists",
+		Message: "категория с таким названием уже существует",
+	}
+	ErrInvalidCategoryName = &Error{
+		Kind:    KindValidation,
+		Code:    "invalid_category_name",
+		Message: "название категории не может быть пустым",
+		Fields:  []FieldError{{Field: "name", Code: "required", Message: "обязательное поле"}},
+	}
+	ErrCategoryHasChildren = &Error{
+		Kind:    KindConflict,
+		Code:    "category_has_children",
+		Message: "у категории есть подкатегории",
+	}
 )
 
 type Category struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
+	// ParentID — родительская категория; nil у корневых категорий
+	ParentID *int `json:"parent_id"`
 }
 
-// Метод для создания таблицы categories
-func (app *App) CreateCategoryTable() {
-	query := `
-	CREATE TABLE IF NOT EXISTS categories (
-		id SERIAL PRIMARY KEY,
-		name TEXT NOT NULL
-	);`
-
-	_, err := app.db.Exec(query)
-	if err != nil {
-		log.Fatal("Ошибка при создании таблицы categories:", err)
-	}
-
-	fmt.Println("Таблица categories успешно создана (если её не было)!")
+// CategoryUpdate — изменения категории. Поля со значением nil не меняются,
+// а родитель меняется, только если SetParent: тогда ParentID nil делает
+// категорию корневой.
+type CategoryUpdate struct {
+	Name      *string
+	SetParent bool
+	ParentID  *int
 }
 
 // Метод для добавления одной записи в таблицу categories
-func (app *App) InsertCategory(name string) {
+func (app *App) InsertCategory(ctx context.Context, name string) error {
 	query := `INSERT INTO categories (name) VALUES ($1)`
-	_, err := app.db.Exec(query, name)
+	_, err := app.db.ExecContext(ctx, query, name)
 	if err != nil {
-		log.Fatal("Ошибка при вставке данных в таблицу categories:", err)
+		return fmt.Errorf("ошибка при вставке данных в таблицу categories: %v", err)
 	}
 
-	fmt.Println("Категория успешно добавлена!")
+	app.logger.DebugContext(ctx, "категория добавлена", "name", name)
+	return nil
 }
 
 // Метод для добавления нескольких категорий
-func (app *App) InsertSampleCategories() {
-	app.InsertCategory("Категория 1")
-	app.InsertCategory("Категория 2")
-	app.InsertCategory("Категория 3")
-	app.InsertCategory("Категория 4")
-	app.InsertCategory("Категория 5")
-	app.InsertCategory("Категория 6")
+func (app *App) InsertSampleCategories(ctx context.Context) error {
+	for i := 1; i <= 6; i++ {
+		if err := app.InsertCategory(ctx, fmt.Sprintf("Категория %d", i)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// Метод для получения всех категорий из таблицы
-func (app *App) GetCategories() ([]Category, error) {
-	query := `SELECT id, name FROM categories;`
+// Метод для получения страницы категорий, упорядоченных по id
+func (app *App) GetCategories(ctx context.Context, limit, offset int) (Page[Category], error) {
+	page := Page[Category]{Items: []Category{}}
+	if err := checkOffset(offset); err != nil {
+		return Page[Category]{}, err
+	}
+	limit = pageLimit(limit)
+
+	if err := app.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM categories`).Scan(&page.Total); err != nil {
+		return page, fmt.Errorf("ошибка при подсчёте категорий: %v", err)
+	}
+
+	query := `SELECT id, name, parent_id FROM categories ORDER BY id LIMIT $1 OFFSET $2`
 
-	rows, err := app.db.Query(query)
+	rows, err := app.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при получении данных из таблицы categories: %v", err)
+		return page, fmt.Errorf("ошибка при получении данных из таблицы categories: %v", err)
 	}
 	defer rows.Close()
 
-	var categories []Category
 	for rows.Next() {
 		var category Category
-		err := rows.Scan(&category.ID, &category.Name)
+		err := rows.Scan(&category.ID, &category.Name, &category.ParentID)
 		if err != nil {
-			return nil, fmt.Errorf("ошибка при сканировании данных из таблицы categories: %v", err)
+			return page, fmt.Errorf("ошибка при сканировании данных из таблицы categories: %v", err)
 		}
-		categories = append(categories, category)
+		page.Items = append(page.Items, category)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка во время обработки строк: %v", err)
+		return page, fmt.Errorf("ошибка во время обработки строк: %v", err)
+	}
+
+	return page, nil
+}
+
+func (app *App) GetCategoryByID(ctx context.Context, id int) (Category, error) {
+	return getCategory(ctx, app.db, id)
+}
+
+// getCategory читает категорию через q.
+func getCategory(ctx context.Context, q querier, id int) (Category, error) {
+	var category Category
+	query := `SELECT id, name, parent_id FROM categories WHERE id = $1`
+	err := q.QueryRowContext(ctx, query, id).Scan(&category.ID, &category.Name, &category.ParentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return category, ErrCategoryNotFound
+	}
+	if err != nil {
+		return category, fmt.Errorf("ошибка при получении категории: %v", err)
+	}
+	return category, nil
+}
+
+// CreateCategory добавляет категорию; parentID nil создаёт корневую категорию.
+func (app *App) CreateCategory(ctx context.Context, name string, parentID *int) (Category, error) {
+	name, err := normalizeCategoryName(name)
+	if err != nil {
+		return Category{}, err
+	}
+
+	category := Category{Name: name, ParentID: parentID}
+	err = app.withTx(ctx, func(tx querier) error {
+		if err := app.checkCategoryParent(ctx, tx, 0, parentID); err != nil {
+			return err
+		}
+		query := `INSERT INTO categories (name, parent_id) VALUES ($1, $2) RETURNING id`
+		err := tx.QueryRowContext(ctx, query, name, parentID).Scan(&category.ID)
+		if app.dialect.violation(err).kind == violationUnique {
+			return ErrCategoryExists
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка при добавлении категории: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return Category{}, err
 	}
+	return category, nil
+}
 
-	return categories, nil
+// UpdateCategory переименовывает категорию и переносит её к другому родителю.
+// Пустое изменение возвращает категорию как есть.
+func (app *App) UpdateCategory(ctx context.Context, id int, update CategoryUpdate) (Category, error) {
+	var set []string
+	var args []interface{}
+	if update.Name != nil {
+		name, err := normalizeCategoryName(*update.Name)
+		if err != nil {
+			return Category{}, err
+		}
+		args = append(args, name)
+		set = append(set, fmt.Sprintf("name = $%d", len(args)))
+	}
+	if update.SetParent {
+		args = append(args, update.ParentID)
+		set = append(set, fmt.Sprintf("parent_id = $%d", len(args)))
+	}
+
+	var category Category
+	err := app.withTx(ctx, func(tx querier) error {
+		if len(set) > 0 {
+			if update.SetParent {
+				if err := app.checkCategoryParent(ctx, tx, id, update.ParentID); err != nil {
+					return err
+				}
+			}
+
+			query := fmt.Sprintf(`UPDATE categories SET %s WHERE id = $%d`, strings.Join(set, ", "), len(args)+1)
+			res, err := tx.ExecContext(ctx, query, append(args, id)...)
+			if app.dialect.violation(err).kind == violationUnique {
+				return ErrCategoryExists
+			}
+			if err != nil {
+				return fmt.Errorf("ошибка при обновлении категории: %v", err)
+			}
+			if err := checkAffected(res, ErrCategoryNotFound); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		category, err = getCategory(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return Category{}, err
+	}
+	return category, nil
+}
+
+// lockCategoryTree блокирует изменения дерева категорий до конца транзакции q.
+func (app *App) lockCategoryTree(ctx context.Context, q querier) error {
+	if app.dialect.lockCategoryTree == "" {
+		return nil
+	}
+	if _, err := q.ExecContext(ctx, app.dialect.lockCategoryTree); err != nil {
+		return fmt.Errorf("ошибка при блокировке дерева категорий: %v", err)
+	}
+	return nil
+}
+
+// checkCategoryParent проверяет, что категорию id можно вложить в parentID:
+// родитель существует и не является самой категорией или её подкатегорией.
+// id = 0 — новая категория. Проверка и изменение выполняются под блокировкой
+// дерева категорий, чтобы два одновременных переноса не замкнули цикл.
+func (app *App) checkCategoryParent(ctx context.Context, q querier, id int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	if err := app.lockCategoryTree(ctx, q); err != nil {
+		return err
+	}
+
+	// Поднимаемся от нового родителя к корню: если по пути встретится сама
+	// категория, перенос замкнёт цикл
+	query := `
+	WITH RECURSIVE ancestors(id, parent_id) AS (
+		SELECT id, parent_id FROM categories WHERE id = $1
+		UNION
+		SELECT c.id, c.parent_id FROM categories c JOIN ancestors a ON c.id = a.parent_id
+	)
+	SELECT COUNT(*), COUNT(CASE WHEN id = $2 THEN 1 END) FROM ancestors`
+
+	var ancestors, cycles int
+	if err := q.QueryRowContext(ctx, query, *parentID, id).Scan(&ancestors, &cycles); err != nil {
+		return fmt.Errorf("ошибка при проверке родительской категории: %v", err)
+	}
+	return parentErrors(*parentID, ancestors > 0, cycles > 0)
+}
+
+// parentErrors описывает ошибку выбора родительской категории parentID:
+// exists — родитель существует, cycle — перенос замкнёт цикл.
+func parentErrors(parentID int, exists, cycle bool) error {
+	switch {
+	case !exists:
+		return NewValidationError(FieldError{
+			Field:   "parent_id",
+			Code:    "not_found",
+			Message: fmt.Sprintf("категория с ID %d не существует", parentID),
+		})
+	case cycle:
+		return NewValidationError(FieldError{
+			Field:   "parent_id",
+			Code:    "cycle",
+			Message: "категорию нельзя вложить в саму себя или в её подкатегорию",
+		})
+	}
+	return nil
+}
+
+// DeleteCategory удаляет категорию и возвращает количество связей с магазинами,
+// удалённых каскадно вместе с ней.
+func (app *App) DeleteCategory(ctx context.Context, id int) (int, error) {
+	var links int
+	err := app.withTx(ctx, func(tx querier) error {
+		// Под блокировкой дерева в категорию не добавят и не перенесут
+		// подкатегорию, пока идёт проверка и удаление
+		if err := app.lockCategoryTree(ctx, tx); err != nil {
+			return err
+		}
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM shop_categories WHERE category_id = $1`, id).Scan(&links)
+		if err != nil {
+			return fmt.Errorf("ошибка при подсчёте связей категории: %v", err)
+		}
+
+		// Подкатегории не удаляются вместе с родителем: их нужно перенести или удалить явно
+		var children int
+		err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM categories WHERE parent_id = $1`, id).Scan(&children)
+		if err != nil {
+			return fmt.Errorf("ошибка при подсчёте подкатегорий: %v", err)
+		}
+		if children > 0 {
+			return ErrCategoryHasChildren
+		}
+
+		// Связи в shop_categories удаляются через ON DELETE CASCADE
+		res, err := tx.ExecContext(ctx, `DELETE FROM categories WHERE id = $1`, id)
+		if err != nil {
+			return fmt.Errorf("ошибка при удалении категории: %v", err)
+		}
+		return checkAffected(res, ErrCategoryNotFound)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return links, nil
+}
+
+// normalizeCategoryName обрезает пробелы по краям и проверяет имя по правилам категории.
+func normalizeCategoryName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", ErrInvalidCategoryName
+	}
+	if errs := validate(Category{Name: name}, categoryRules, nil); len(errs) > 0 {
+		return "", NewValidationError(errs...)
+	}
+	return name, nil
 }
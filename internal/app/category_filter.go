@@ -0,0 +1,138 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CategoryMatch задаёт, к скольким категориям из CategoryFilter.IDs должен
+// быть привязан магазин.
+type CategoryMatch string
+
+const (
+	// MatchAny — хотя бы к одной из категорий (значение по умолчанию).
+	MatchAny CategoryMatch = "any"
+	// MatchAll — ко всем категориям сразу.
+	MatchAll CategoryMatch = "all"
+)
+
+// CategoryFilter — отбор магазинов по категориям. Пустой фильтр пропускает все магазины.
+type CategoryFilter struct {
+	// IDs — категории, к которым должен быть привязан магазин
+	IDs []int
+	// Match — MatchAny или MatchAll; пустое значение означает MatchAny
+	Match CategoryMatch
+	// Exclude — категории, магазины которых не попадают в выборку,
+	// даже если привязаны и к категориям из IDs
+	Exclude []int
+	// Descendants — каждая категория из IDs и Exclude включает свои подкатегории
+	// на любой глубине: магазин подкатегории считается магазином родителя
+	Descendants bool
+}
+
+// validate проверяет значение Match.
+func (f CategoryFilter) validate() *FieldError {
+	switch f.Match {
+	case "", MatchAny, MatchAll:
+		return nil
+	}
+	return &FieldError{
+		Field:   "match",
+		Code:    "invalid_value",
+		Message: fmt.Sprintf("ожидается %q или %q, получено %q", MatchAny, MatchAll, f.Match),
+	}
+}
+
+// condition строит условие фильтра для магазина s. Параметры условия
+// добавляются в args; пустой фильтр даёт пустое условие.
+func (f CategoryFilter) condition(args []interface{}) (string, []interface{}) {
+	var conditions []string
+	if ids := uniqueIDs(f.IDs); len(ids) > 0 && f.Match == MatchAll {
+		// Каждая категория должна найтись среди категорий магазина
+		for _, id := range ids {
+			var set string
+			set, args = f.categorySet(args, []int{id})
+			conditions = append(conditions, fmt.Sprintf(
+				`EXISTS (SELECT 1 FROM shop_categories sc WHERE sc.shop_id = s.id AND sc.category_id IN (%s))`, set))
+		}
+	} else if len(ids) > 0 {
+		var set string
+		set, args = f.categorySet(args, ids)
+		conditions = append(conditions, fmt.Sprintf(
+			`EXISTS (SELECT 1 FROM shop_categories sc WHERE sc.shop_id = s.id AND sc.category_id IN (%s))`, set))
+	}
+	if ids := uniqueIDs(f.Exclude); len(ids) > 0 {
+		var set string
+		set, args = f.categorySet(args, ids)
+		conditions = append(conditions, fmt.Sprintf(
+			`NOT EXISTS (SELECT 1 FROM shop_categories sc WHERE sc.shop_id = s.id AND sc.category_id IN (%s))`, set))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// categorySet возвращает содержимое IN (...) для категорий ids: список
+// плейсхолдеров или, при Descendants, подзапрос вместе с подкатегориями.
+func (f CategoryFilter) categorySet(args []interface{}, ids []int) (string, []interface{}) {
+	list, args := appendPlaceholders(args, ids)
+	if f.Descendants {
+		return subtreeQuery(list), args
+	}
+	return list, args
+}
+
+// matcher возвращает проверку фильтра по множеству категорий магазина.
+// subtree возвращает категорию вместе со всеми подкатегориями и нужна только
+// при Descendants.
+func (f CategoryFilter) matcher(subtree func(id int) []int) func(linked map[int]struct{}) bool {
+	expand := func(id int) []int {
+		if f.Descendants {
+			return subtree(id)
+		}
+		return []int{id}
+	}
+	var include [][]int
+	for _, id := range uniqueIDs(f.IDs) {
+		include = append(include, expand(id))
+	}
+	var exclude []int
+	for _, id := range uniqueIDs(f.Exclude) {
+		exclude = append(exclude, expand(id)...)
+	}
+
+	linkedAny := func(linked map[int]struct{}, ids []int) bool {
+		for _, id := range ids {
+			if _, ok := linked[id]; ok {
+				return true
+			}
+		}
+		return false
+	}
+	return func(linked map[int]struct{}) bool {
+		if linkedAny(linked, exclude) {
+			return false
+		}
+		if len(include) == 0 {
+			return true
+		}
+		for _, ids := range include {
+			ok := linkedAny(linked, ids)
+			if ok && f.Match != MatchAll {
+				return true
+			}
+			if !ok && f.Match == MatchAll {
+				return false
+			}
+		}
+		return f.Match == MatchAll
+	}
+}
+
+// appendPlaceholders добавляет ids в args и возвращает их плейсхолдеры через запятую.
+func appendPlaceholders(args []interface{}, ids []int) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	for i, id := range ids {
+		args = append(args, id)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	return strings.Join(placeholders, ", "), args
+}
@@ -0,0 +1,169 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Количество последних добавленных магазинов в статистике категории.
+const (
+	DefaultRecentShops = 3
+	MaxRecentShops     = 20
+)
+
+// CategoryStats — сводка по магазинам категории. Цены пустой категории равны nil.
+type CategoryStats struct {
+	Category
+	ShopCount   int      `json:"shop_count"`
+	MinPrice    *int     `json:"min_price"`
+	MaxPrice    *int     `json:"max_price"`
+	AvgPrice    *float64 `json:"avg_price"`
+	MedianPrice *float64 `json:"median_price"`
+	// RecentShops — последние добавленные магазины категории, новые первыми.
+	// Магазины добавляются с возрастающими id, поэтому новее тот, у кого id больше.
+	RecentShops []Shop `json:"recent_shops"`
+}
+
+// GetCategoryStats считает статистику по всем категориям, упорядоченным по id;
+// recent — сколько последних магазинов вернуть для каждой категории.
+func (app *App) GetCategoryStats(ctx context.Context, recent int) ([]CategoryStats, error) {
+	query := `
+	SELECT c.id, c.name, c.parent_id, COUNT(s.id), MIN(s.price), MAX(s.price), AVG(s.price)
+	FROM categories c
+	LEFT JOIN shop_categories sc ON sc.category_id = c.id
+	LEFT JOIN shops s ON s.id = sc.shop_id
+	GROUP BY c.id, c.name, c.parent_id
+	ORDER BY c.id`
+
+	rows, err := app.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при подсчёте статистики категорий: %v", err)
+	}
+	defer rows.Close()
+
+	stats := []CategoryStats{}
+	byID := make(map[int]*CategoryStats)
+	for rows.Next() {
+		var s CategoryStats
+		if err := rows.Scan(&s.ID, &s.Name, &s.ParentID, &s.ShopCount, &s.MinPrice, &s.MaxPrice, &s.AvgPrice); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования данных: %v", err)
+		}
+		s.RecentShops = []Shop{}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка во время обработки строк: %v", err)
+	}
+	rows.Close()
+	for i := range stats {
+		byID[stats[i].ID] = &stats[i]
+	}
+
+	if err := app.categoryMedians(ctx, byID); err != nil {
+		return nil, err
+	}
+	if err := app.recentCategoryShops(ctx, byID, recent); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// categoryMedians заполняет медианы цен. Магазины каждой категории нумеруются
+// по цене, и медиана — среднее одной или двух средних по номеру цен.
+func (app *App) categoryMedians(ctx context.Context, byID map[int]*CategoryStats) error {
+	query := `
+	SELECT category_id, AVG(price)
+	FROM (
+		SELECT sc.category_id, s.price,
+			ROW_NUMBER() OVER (PARTITION BY sc.category_id ORDER BY s.price) AS n,
+			COUNT(*) OVER (PARTITION BY sc.category_id) AS total
+		FROM shop_categories sc
+		JOIN shops s ON s.id = sc.shop_id
+	) ranked
+	WHERE n IN ((total + 1) / 2, (total + 2) / 2)
+	GROUP BY category_id`
+
+	rows, err := app.db.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("ошибка при подсчёте медианы цен: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var median float64
+		if err := rows.Scan(&id, &median); err != nil {
+			return fmt.Errorf("ошибка сканирования данных: %v", err)
+		}
+		if s, ok := byID[id]; ok {
+			s.MedianPrice = &median
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка во время обработки строк: %v", err)
+	}
+	return nil
+}
+
+// recentCategoryShops заполняет до recent последних добавленных магазинов каждой категории.
+func (app *App) recentCategoryShops(ctx context.Context, byID map[int]*CategoryStats, recent int) error {
+	query := `
+	SELECT category_id, id, name, image, price, description
+	FROM (
+		SELECT sc.category_id, s.id, s.name, s.image, s.price, s.description,
+			ROW_NUMBER() OVER (PARTITION BY sc.category_id ORDER BY s.id DESC) AS n
+		FROM shop_categories sc
+		JOIN shops s ON s.id = sc.shop_id
+	) ranked
+	WHERE n <= $1
+	ORDER BY category_id, id DESC`
+
+	rows, err := app.db.QueryContext(ctx, query, recent)
+	if err != nil {
+		return fmt.Errorf("ошибка при получении последних магазинов категорий: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var shop Shop
+		if err := rows.Scan(&id, &shop.ID, &shop.Name, &shop.Image, &shop.Price, &shop.Description); err != nil {
+			return fmt.Errorf("ошибка сканирования данных: %v", err)
+		}
+		if s, ok := byID[id]; ok {
+			s.RecentShops = append(s.RecentShops, shop)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка во время обработки строк: %v", err)
+	}
+	return nil
+}
+
+// categoryStats считает статистику категории по её магазинам, упорядоченным по id.
+// Повторяет GetCategoryStats для хранилища в памяти.
+func categoryStats(category Category, shops []Shop, recent int) CategoryStats {
+	s := CategoryStats{Category: category, ShopCount: len(shops), RecentShops: []Shop{}}
+	if len(shops) == 0 {
+		return s
+	}
+
+	prices := make([]int, len(shops))
+	sum := 0
+	for i, shop := range shops {
+		prices[i] = shop.Price
+		sum += shop.Price
+	}
+	sort.Ints(prices)
+
+	minPrice, maxPrice := prices[0], prices[len(prices)-1]
+	avg := float64(sum) / float64(len(prices))
+	median := float64(prices[(len(prices)-1)/2]+prices[len(prices)/2]) / 2
+	s.MinPrice, s.MaxPrice, s.AvgPrice, s.MedianPrice = &minPrice, &maxPrice, &avg, &median
+
+	for i := len(shops) - 1; i >= 0 && len(s.RecentShops) < recent; i-- {
+		s.RecentShops = append(s.RecentShops, shops[i])
+	}
+	return s
+}
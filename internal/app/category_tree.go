@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"fmt"
+)
+
+// categoryTreeLockID — ключ advisory lock, под которым категории переносятся
+// к другому родителю и удаляются.
+const categoryTreeLockID = 7_281_034_156
+
+// CategoryNode — категория вместе с подкатегориями.
+type CategoryNode struct {
+	Category
+	Children []CategoryNode `json:"children"`
+}
+
+// buildCategoryTree собирает дерево из списка категорий, упорядоченного по id.
+// Подкатегории тоже упорядочены по id.
+func buildCategoryTree(categories []Category) []CategoryNode {
+	children := make(map[int][]Category)
+	var roots []Category
+	for _, category := range categories {
+		if category.ParentID == nil {
+			roots = append(roots, category)
+		} else {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	var build func(level []Category) []CategoryNode
+	build = func(level []Category) []CategoryNode {
+		nodes := make([]CategoryNode, 0, len(level))
+		for _, category := range level {
+			nodes = append(nodes, CategoryNode{Category: category, Children: build(children[category.ID])})
+		}
+		return nodes
+	}
+	return build(roots)
+}
+
+// GetCategoryTree возвращает все категории в виде дерева.
+func (app *App) GetCategoryTree(ctx context.Context) ([]CategoryNode, error) {
+	rows, err := app.db.QueryContext(ctx, `SELECT id, name, parent_id FROM categories ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении данных из таблицы categories: %v", err)
+	}
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		var category Category
+		if err := rows.Scan(&category.ID, &category.Name, &category.ParentID); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании данных из таблицы categories: %v", err)
+		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка во время обработки строк: %v", err)
+	}
+	return buildCategoryTree(categories), nil
+}
+
+// GetCategoryPath возвращает «хлебные крошки» категории: путь от корневой
+// категории до неё самой включительно. UNION здесь не спасёт от цикла в данных:
+// строки различаются глубиной, поэтому пройденные категории копятся в visited,
+// и подъём останавливается на первой повторной.
+func (app *App) GetCategoryPath(ctx context.Context, id int) ([]Category, error) {
+	query := `
+	WITH RECURSIVE path(id, name, parent_id, depth, visited) AS (
+		SELECT id, name, parent_id, 0, ',' || id || ',' FROM categories WHERE id = $1
+		UNION ALL
+		SELECT c.id, c.name, c.parent_id, p.depth + 1, p.visited || c.id || ','
+		FROM categories c
+		JOIN path p ON c.id = p.parent_id
+		WHERE p.visited NOT LIKE '%,' || c.id || ',%'
+	)
+	SELECT id, name, parent_id FROM path ORDER BY depth DESC`
+
+	rows, err := app.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении пути категории: %v", err)
+	}
+	defer rows.Close()
+
+	path := []Category{}
+	for rows.Next() {
+		var category Category
+		if err := rows.Scan(&category.ID, &category.Name, &category.ParentID); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании данных из таблицы categories: %v", err)
+		}
+		path = append(path, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка во время обработки строк: %v", err)
+	}
+	if len(path) == 0 {
+		return nil, ErrCategoryNotFound
+	}
+	return path, nil
+}
+
+// subtreeQuery — подзапрос, возвращающий категории из списка list вместе со
+// всеми вложенными. UNION вместо UNION ALL защищает от бесконечной рекурсии,
+// даже если в данных окажется цикл.
+func subtreeQuery(list string) string {
+	return fmt.Sprintf(`
+		WITH RECURSIVE subtree(id) AS (
+			SELECT id FROM categories WHERE id IN (%s)
+			UNION
+			SELECT c.id FROM categories c JOIN subtree t ON c.parent_id = t.id
+		)
+		SELECT id FROM subtree`, list)
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// dialect описывает различия между поддерживаемыми СУБД. Запросы к таблицам
+// записываются один раз: обе СУБД понимают плейсхолдеры $N, RETURNING и LIMIT/OFFSET,
+// а отличия в схеме (SERIAL, каскадное удаление) вынесены в отдельные миграции.
+type dialect struct {
+	name string
+	// driver — имя драйвера database/sql
+	driver string
+	// migrations — каталог встроенных миграций
+	migrations string
+	// schemaMigrations — DDL таблицы применённых миграций
+	schemaMigrations string
+	// hasSchemaMigrations — запрос, возвращающий true, если таблица
+	// schema_migrations уже создана
+	hasSchemaMigrations string
+	// lockMigrations захватывает блокировку миграций на соединении
+	// и возвращает функцию её освобождения.
+	lockMigrations func(ctx context.Context, conn *sql.Conn) (func(), error)
+	// jsonArrayAgg собирает значения expr в JSON-массив, упорядоченный по orderBy;
+	// для пустой выборки возвращает пустой массив.
+	jsonArrayAgg func(expr, orderBy string) string
+	// jsonObject — функция, собирающая JSON-объект из пар ключ-значение
+	jsonObject string
+	// forUpdate блокирует выбранные строки до конца транзакции; SQLite
+	// и так сериализует транзакции на единственном соединении.
+	forUpdate string
+	// lockCategoryTree блокирует перенос и удаление категорий до конца транзакции;
+	// пустая строка — блокировка не нужна
+	lockCategoryTree string
+	// search возвращает SQL полнотекстового поиска; параметры запроса
+	// нумеруются с $first
+	search func(first int) shopSearch
+	// searchArgs готовит значения параметров для search по запросу пользователя
+	searchArgs func(query string, terms []searchTerm) []interface{}
+	// trigram — в СУБД есть pg_trgm; иначе опечатки ищет fuzzyIndex в памяти процесса
+	trigram bool
+	// violation распознаёт в ошибке драйвера нарушение ограничения.
+	violation func(err error) violation
+}
+
+var postgresDialect = &dialect{
+	name:       "postgres",
+	driver:     "postgres",
+	migrations: "migrations/postgres",
+	schemaMigrations: `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`,
+	hasSchemaMigrations: `SELECT to_regclass('schema_migrations') IS NOT NULL`,
+	lockMigrations: func(ctx context.Context, conn *sql.Conn) (func(), error) {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+			return nil, err
+		}
+		return func() {
+			// Блокировку нужно снять и после отмены ctx: соединение вернётся в пул
+			conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+		}, nil
+	},
+	jsonArrayAgg: func(expr, orderBy string) string {
+		return fmt.Sprintf("COALESCE(json_agg(%s ORDER BY %s), '[]')", expr, orderBy)
+	},
+	jsonObject:       "json_build_object",
+	forUpdate:        " FOR UPDATE",
+	lockCategoryTree: fmt.Sprintf(`SELECT pg_advisory_xact_lock(%d)`, categoryTreeLockID),
+	search:           postgresSearch,
+	searchArgs:       postgresSearchArgs,
+	trigram:          true,
+	violation:        pgViolation,
+}
+
+var sqliteDialect = &dialect{
+	name:       "sqlite",
+	driver:     "sqlite",
+	migrations: "migrations/sqlite",
+	schemaMigrations: `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`,
+	hasSchemaMigrations: `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')`,
+	// SQLite сам сериализует запись в файл, а транзакция каждой миграции
+	// вместе с записью в schema_migrations не даст применить её дважды.
+	lockMigrations: func(ctx context.Context, conn *sql.Conn) (func(), error) {
+		return func() {}, nil
+	},
+	jsonArrayAgg: func(expr, orderBy string) string {
+		return fmt.Sprintf("json_group_array(%s ORDER BY %s)", expr, orderBy)
+	},
+	jsonObject: "json_object",
+	search:     sqliteSearch,
+	searchArgs: sqliteSearchArgs,
+	violation:  sqliteViolation,
+}
+
+// parseDSN выбирает СУБД по схеме строки подключения и возвращает строку
+// в формате, который понимает драйвер. Для SQLite принимаются sqlite://путь,
+// sqlite:путь и file:путь; внешние ключи включаются всегда, иначе не работает
+// ON DELETE CASCADE.
+func parseDSN(dsn string) (*dialect, string, error) {
+	scheme, rest, ok := strings.Cut(dsn, ":")
+	if !ok {
+		return nil, "", fmt.Errorf("в строке подключения не указана схема: %q", dsn)
+	}
+
+	switch strings.ToLower(scheme) {
+	case "postgres", "postgresql":
+		return postgresDialect, dsn, nil
+	case "sqlite", "sqlite3", "file":
+		path := strings.TrimPrefix(rest, "//")
+		path, rawQuery, _ := strings.Cut(path, "?")
+		if path == "" {
+			return nil, "", fmt.Errorf("в строке подключения SQLite не указан путь к файлу: %q", dsn)
+		}
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return nil, "", fmt.Errorf("некорректные параметры строки подключения: %v", err)
+		}
+		query.Add("_pragma", "foreign_keys(1)")
+		query.Add("_pragma", "busy_timeout(5000)")
+		query.Add("_pragma", "journal_mode(WAL)")
+		return sqliteDialect, "file:" + path + "?" + query.Encode(), nil
+	default:
+		return nil, "", fmt.Errorf("неподдерживаемая схема строки подключения: %q", scheme)
+	}
+}
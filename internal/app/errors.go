@@ -0,0 +1,93 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind — класс ошибки, по которому сервер выбирает HTTP-статус.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindNotFound
+	KindValidation
+	KindConflict
+	KindForeignKey
+)
+
+// FieldError описывает ошибку в одном поле входных данных.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error — типизированная ошибка предметной области. Code — машинно-читаемый код,
+// на который могут опираться клиенты; Message — описание для человека.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Fields  []FieldError
+	// Err — исходная ошибка, если она есть
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is сравнивает ошибки по коду, поэтому errors.Is(err, ErrShopNotFound) срабатывает
+// и для копий с уточнённым сообщением или полями.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// With возвращает копию ошибки с уточнённым сообщением.
+func (e *Error) With(format string, args ...interface{}) *Error {
+	c := *e
+	c.Message = fmt.Sprintf(format, args...)
+	return &c
+}
+
+// KindOf возвращает класс ошибки или KindInternal для нетипизированных ошибок.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindInternal
+}
+
+// NewValidationError собирает ошибку валидации из ошибок отдельных полей.
+func NewValidationError(fields ...FieldError) *Error {
+	return &Error{
+		Kind:    KindValidation,
+		Code:    "validation_failed",
+		Message: "данные не прошли проверку",
+		Fields:  fields,
+	}
+}
+
+// newForeignKeyError сообщает, что запись ссылается на несуществующую категорию.
+func newForeignKeyError(categoryID int) *Error {
+	return &Error{
+		Kind:    KindForeignKey,
+		Code:    "category_reference_invalid",
+		Message: fmt.Sprintf("категория с ID %d не существует", categoryID),
+		Fields: []FieldError{{
+			Field:   "categories",
+			Code:    "not_found",
+			Message: fmt.Sprintf("категория с ID %d не существует", categoryID),
+		}},
+	}
+}
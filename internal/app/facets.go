@@ -0,0 +1,223 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// MaxPriceBuckets — наибольшее количество границ ценовых диапазонов.
+const MaxPriceBuckets = 20
+
+// DefaultPriceBuckets — границы ценовых диапазонов, если они не указаны:
+// до 99, 100–499, 500–999, 1000–4999 и от 5000.
+var DefaultPriceBuckets = []int{100, 500, 1000, 5000}
+
+// FacetParams — параметры подсчёта фасетов для списка магазинов.
+type FacetParams struct {
+	// Query — поисковый запрос; пустой запрос — фасеты по всем магазинам
+	Query string
+	// Фильтры по цене и категориям, как у списка магазинов; сортировка и
+	// пагинация не учитываются
+	ShopListParams
+	// PriceBuckets — возрастающие границы ценовых диапазонов; nil — DefaultPriceBuckets
+	PriceBuckets []int
+}
+
+// ShopFacets — количество магазинов по категориям и ценовым диапазонам.
+type ShopFacets struct {
+	Categories []CategoryFacet `json:"categories"`
+	Prices     []PriceFacet    `json:"prices"`
+}
+
+// CategoryFacet — количество подходящих магазинов в категории.
+type CategoryFacet struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// PriceFacet — количество подходящих магазинов в ценовом диапазоне. Границы
+// включаются, поэтому их можно передать в min_price и max_price как есть;
+// nil — диапазон не ограничен с этой стороны.
+type PriceFacet struct {
+	MinPrice *int `json:"min_price,omitempty"`
+	MaxPrice *int `json:"max_price,omitempty"`
+	Count    int  `json:"count"`
+}
+
+// validate проверяет фильтры и границы ценовых диапазонов.
+func (p FacetParams) validate() error {
+	errs := p.ShopListParams.validate()
+	if len(p.PriceBuckets) > MaxPriceBuckets {
+		errs = append(errs, FieldError{
+			Field:   "price_buckets",
+			Code:    "too_many",
+			Message: fmt.Sprintf("не больше %d границ", MaxPriceBuckets),
+		})
+	}
+	for i := 1; i < len(p.PriceBuckets); i++ {
+		if p.PriceBuckets[i] <= p.PriceBuckets[i-1] {
+			errs = append(errs, FieldError{
+				Field:   "price_buckets",
+				Code:    "invalid_range",
+				Message: "границы ценовых диапазонов должны возрастать",
+			})
+			break
+		}
+	}
+	if len(errs) > 0 {
+		return NewValidationError(errs...)
+	}
+	return nil
+}
+
+// buckets возвращает границы ценовых диапазонов.
+func (p FacetParams) buckets() []int {
+	if p.PriceBuckets == nil {
+		return DefaultPriceBuckets
+	}
+	return p.PriceBuckets
+}
+
+// categoryParams — фильтры для фасета категорий. Фильтр по категориям в нём не
+// учитывается, если достаточно совпадения с одной из них: тогда счётчик
+// показывает, сколько магазинов добавится при выборе категории. При match=all
+// фильтр остаётся, и счётчик показывает, сколько магазинов останется.
+// Исключённые категории учитываются всегда.
+func (p FacetParams) categoryParams() ShopListParams {
+	params := p.ShopListParams
+	if params.Categories.Match != MatchAll {
+		params.Categories.IDs = nil
+	}
+	return params
+}
+
+// priceParams — фильтры для фасета цен: все, кроме самого диапазона цен.
+func (p FacetParams) priceParams() ShopListParams {
+	params := p.ShopListParams
+	params.MinPrice, params.MaxPrice = nil, nil
+	return params
+}
+
+// newPriceFacets строит пустые ценовые диапазоны по границам buckets: цены
+// меньше первой границы, между соседними границами и не меньше последней.
+func newPriceFacets(buckets []int) []PriceFacet {
+	facets := make([]PriceFacet, len(buckets)+1)
+	for i, bound := range buckets {
+		minPrice, maxPrice := bound, bound-1
+		facets[i].MaxPrice = &maxPrice
+		facets[i+1].MinPrice = &minPrice
+	}
+	return facets
+}
+
+// priceBucket возвращает номер диапазона, в который попадает цена.
+func priceBucket(buckets []int, price int) int {
+	i := 0
+	for i < len(buckets) && price >= buckets[i] {
+		i++
+	}
+	return i
+}
+
+// GetShopFacets считает магазины, подходящие под фильтры params, по категориям
+// и ценовым диапазонам. Каждый фасет не учитывает собственный фильтр, чтобы
+// показать, что изменится при его выборе.
+func (app *App) GetShopFacets(ctx context.Context, params FacetParams) (ShopFacets, error) {
+	if err := params.validate(); err != nil {
+		return ShopFacets{}, err
+	}
+
+	sq := shopQuery{}
+	if params.Query != "" {
+		var ok bool
+		var err error
+		if sq, ok, err = app.searchQuery(ctx, params.Query); err != nil {
+			return ShopFacets{}, err
+		}
+		if !ok {
+			// В запросе нет слов: поиск ничего не находит
+			sq = shopQuery{filter: "FALSE"}
+		}
+	}
+
+	facets := ShopFacets{Prices: newPriceFacets(params.buckets())}
+	var err error
+	if facets.Categories, err = app.categoryFacets(ctx, sq, params.categoryParams()); err != nil {
+		return ShopFacets{}, err
+	}
+	if err := app.priceFacets(ctx, sq, params.priceParams(), params.buckets(), facets.Prices); err != nil {
+		return ShopFacets{}, err
+	}
+	return facets, nil
+}
+
+// categoryFacets считает подходящие магазины в каждой категории, включая пустые.
+func (app *App) categoryFacets(ctx context.Context, sq shopQuery, params ShopListParams) ([]CategoryFacet, error) {
+	where, args := shopFilter(sq, params)
+	query := fmt.Sprintf(`
+	SELECT c.id, c.name, COUNT(f.id)
+	FROM categories c
+	LEFT JOIN shop_categories sc ON sc.category_id = c.id
+	LEFT JOIN (SELECT s.id FROM shops s %s WHERE %s) f ON f.id = sc.shop_id
+	GROUP BY c.id, c.name
+	ORDER BY c.id`, sq.from, where)
+
+	rows, err := app.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при подсчёте магазинов по категориям: %v", err)
+	}
+	defer rows.Close()
+
+	facets := []CategoryFacet{}
+	for rows.Next() {
+		var facet CategoryFacet
+		if err := rows.Scan(&facet.ID, &facet.Name, &facet.Count); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования данных: %v", err)
+		}
+		facets = append(facets, facet)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка во время обработки строк: %v", err)
+	}
+	return facets, nil
+}
+
+// priceFacets считает подходящие магазины в ценовых диапазонах facets.
+func (app *App) priceFacets(ctx context.Context, sq shopQuery, params ShopListParams, buckets []int, facets []PriceFacet) error {
+	where, args := shopFilter(sq, params)
+
+	// Номер диапазона: количество границ, не превышающих цену
+	var bucket strings.Builder
+	bucket.WriteString("CASE")
+	for i, bound := range buckets {
+		args = append(args, bound)
+		fmt.Fprintf(&bucket, " WHEN s.price < $%d THEN %d", len(args), i)
+	}
+	fmt.Fprintf(&bucket, " ELSE %d END", len(buckets))
+
+	query := fmt.Sprintf(`
+	SELECT %s AS bucket, COUNT(*)
+	FROM shops s %s
+	WHERE %s
+	GROUP BY bucket`, bucket.String(), sq.from, where)
+
+	rows, err := app.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("ошибка при подсчёте магазинов по ценам: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i, count int
+		if err := rows.Scan(&i, &count); err != nil {
+			return fmt.Errorf("ошибка сканирования данных: %v", err)
+		}
+		facets[i].Count = count
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка во время обработки строк: %v", err)
+	}
+	return nil
+}
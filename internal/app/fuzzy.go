@@ -0,0 +1,435 @@
+package app
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// DefaultSuggestLimit и MaxSuggestLimit — число подсказок по умолчанию и наибольшее.
+const (
+	DefaultSuggestLimit = 10
+	MaxSuggestLimit     = 50
+)
+
+// Suggestion — подсказка для поля поиска: название магазина или категории.
+type Suggestion struct {
+	// Type — "shop" или "category"
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// typoLimit — сколько опечаток допускается в слове из n букв. В словах из одной
+// и двух букв опечатки не исправляются: «он» иначе находил бы и «от», и «до».
+func typoLimit(n int) int {
+	switch {
+	case n < 3:
+		return 0
+	case n <= 5:
+		return 1
+	}
+	return 2
+}
+
+// fuzzyIndex — индекс для поиска с опечатками, который строится в памяти процесса
+// для хранилища в памяти и SQLite: словарь слов названий и описаний и список
+// названий для подсказок.
+type fuzzyIndex struct {
+	// words — отсортированный словарь без повторов, runes — те же слова в рунах
+	words []string
+	runes [][]rune
+	// names — названия магазинов и категорий, nameWords — их слова, nameTexts —
+	// те же слова через пробел, nameLengths — длины названий в буквах,
+	// byWord — номера названий по их словам
+	names       []Suggestion
+	nameWords   [][]string
+	nameTexts   []string
+	nameLengths []int
+	byWord      map[string][]int
+}
+
+// fuzzySnapshot — построенный индекс и поколение данных, по которому он построен.
+type fuzzySnapshot struct {
+	index      *fuzzyIndex
+	generation int64
+}
+
+// fuzzyCache хранит последний построенный индекс. Построение индекса по всем
+// магазинам занимает заметное время, поэтому после изменения данных индекс
+// перестраивается в фоне, а запросы до его замены пользуются прежним.
+type fuzzyCache struct {
+	current atomic.Pointer[fuzzySnapshot]
+	// building — идёт фоновое построение; одновременно строится один индекс
+	building atomic.Bool
+	// mu не даёт первым запросам строить индекс одновременно
+	mu sync.Mutex
+}
+
+// get возвращает последний построенный индекс. Если он построен не для поколения
+// generation, prepare готовит построение нового: сама prepare вызывается сразу,
+// под блокировками вызывающего, чтобы снять копию данных, а возвращённая ею
+// функция строит индекс в фоне. Только первый индекс строится в самом запросе —
+// до него отвечать нечем.
+func (c *fuzzyCache) get(generation int64, prepare func() func() (*fuzzyIndex, error)) (*fuzzyIndex, error) {
+	if s := c.current.Load(); s != nil {
+		if s.generation != generation && c.building.CompareAndSwap(false, true) {
+			build := prepare()
+			go func() {
+				defer c.building.Store(false)
+				// При ошибке остаётся прежний индекс, следующий запрос попробует снова
+				if index, err := build(); err == nil {
+					c.current.Store(&fuzzySnapshot{index: index, generation: generation})
+				}
+			}()
+		}
+		return s.index, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s := c.current.Load(); s != nil {
+		return s.index, nil
+	}
+	index, err := prepare()()
+	if err != nil {
+		return nil, err
+	}
+	c.current.Store(&fuzzySnapshot{index: index, generation: generation})
+	return index, nil
+}
+
+// newFuzzyIndex строит индекс по названиям и описаниям магазинов и названиям категорий.
+func newFuzzyIndex(shops []Shop, categories []Category) *fuzzyIndex {
+	index := &fuzzyIndex{byWord: make(map[string][]int)}
+	vocabulary := make(map[string]bool)
+
+	addName := func(s Suggestion) {
+		n := len(index.names)
+		words := strings.FieldsFunc(normalizeSearchText(s.Name), isWordSeparator)
+		index.names = append(index.names, s)
+		index.nameWords = append(index.nameWords, words)
+		index.nameTexts = append(index.nameTexts, strings.Join(words, " "))
+		index.nameLengths = append(index.nameLengths, utf8.RuneCountInString(s.Name))
+		for _, word := range words {
+			vocabulary[word] = true
+			if ids := index.byWord[word]; len(ids) == 0 || ids[len(ids)-1] != n {
+				index.byWord[word] = append(ids, n)
+			}
+		}
+	}
+	for _, shop := range shops {
+		addName(Suggestion{Type: "shop", ID: shop.ID, Name: shop.Name})
+		for _, word := range strings.FieldsFunc(normalizeSearchText(shop.Description), isWordSeparator) {
+			vocabulary[word] = true
+		}
+	}
+	for _, category := range categories {
+		addName(Suggestion{Type: "category", ID: category.ID, Name: category.Name})
+	}
+
+	index.words = make([]string, 0, len(vocabulary))
+	for word := range vocabulary {
+		index.words = append(index.words, word)
+	}
+	sort.Strings(index.words)
+	index.runes = make([][]rune, len(index.words))
+	for i, word := range index.words {
+		index.runes[i] = []rune(word)
+	}
+	return index
+}
+
+// prefixRange возвращает границы слов словаря, начинающихся с prefix.
+func (index *fuzzyIndex) prefixRange(prefix string) (int, int) {
+	from := sort.SearchStrings(index.words, prefix)
+	to := from
+	for to < len(index.words) && strings.HasPrefix(index.words[to], prefix) {
+		to++
+	}
+	return from, to
+}
+
+// similar возвращает слова словаря, начало которых отличается от prefix не больше
+// чем на typoLimit опечаток, и число опечаток в каждом. Слова, начинающиеся
+// с самого prefix, не возвращаются.
+//
+// Словарь отсортирован, поэтому он обходится как префиксное дерево: столбцы
+// таблицы расстояний для общего с предыдущим словом начала не пересчитываются,
+// а слова с началом, которое уже дальше limit от prefix, пропускаются целиком.
+func (index *fuzzyIndex) similar(prefix string) map[string]int {
+	p := []rune(prefix)
+	limit := typoLimit(len(p))
+	if limit == 0 {
+		return nil
+	}
+
+	// columns[j][i] — расстояние между p[:i] и началом слова длины j,
+	// nearest[j] — наименьшее расстояние от p до начал слова не длиннее j
+	depth := len(p) + limit
+	columns := make([][]int, depth+1)
+	for j := range columns {
+		columns[j] = make([]int, len(p)+1)
+	}
+	for i := range columns[0] {
+		columns[0][i] = i
+	}
+	nearest := make([]int, depth+1)
+	nearest[0] = len(p)
+
+	found := make(map[string]int)
+	var prev []rune
+	for w := 0; w < len(index.runes); {
+		word := index.runes[w]
+		j := 0
+		for j < len(prev) && j < len(word) && prev[j] == word[j] {
+			j++
+		}
+		j = min(j, len(word), depth)
+		prev = word
+
+		pruned := false
+		for j < len(word) && j < depth {
+			j++
+			column, last := columns[j], columns[j-1]
+			column[0] = j
+			rowMin := j
+			for i := 1; i <= len(p); i++ {
+				cost := 1
+				if p[i-1] == word[j-1] {
+					cost = 0
+				}
+				column[i] = min(last[i]+1, column[i-1]+1, last[i-1]+cost)
+				if i > 1 && j > 1 && p[i-1] == word[j-2] && p[i-2] == word[j-1] {
+					column[i] = min(column[i], columns[j-2][i-2]+1)
+				}
+				rowMin = min(rowMin, column[i])
+			}
+			nearest[j] = min(nearest[j-1], column[len(p)])
+			if rowMin > limit {
+				pruned = true
+				break
+			}
+		}
+
+		// Дальше начала word[:j] расстояние только растёт, поэтому у всех слов
+		// с этим началом оно одинаковое и равно nearest[j]
+		next := w + 1
+		if pruned {
+			stem := string(word[:j])
+			next = w + sort.Search(len(index.words)-w, func(k int) bool {
+				return !strings.HasPrefix(index.words[w+k], stem)
+			})
+		}
+		if n := nearest[j]; n > 0 && n <= limit {
+			for _, similar := range index.words[w:next] {
+				found[similar] = n
+			}
+		}
+		w = next
+	}
+	return found
+}
+
+// expand добавляет к словам запроса, которых нет в словаре, похожие слова
+// словаря — так поиск находит «магазин» по запросу «магизин».
+func (index *fuzzyIndex) expand(terms []searchTerm) []searchTerm {
+	const maxCorrections = 5
+
+	expanded := make([]searchTerm, len(terms))
+	for i, term := range terms {
+		expanded[i] = term
+		direct := term[0]
+		if len(direct) != 1 {
+			continue
+		}
+		if from, to := index.prefixRange(direct[0]); from < to {
+			continue
+		}
+
+		words := sortedBySimilarity(index.similar(direct[0]))
+		if len(words) > maxCorrections {
+			words = words[:maxCorrections]
+		}
+
+		expanded[i] = append(searchTerm{}, term...)
+		for _, word := range words {
+			expanded[i] = append(expanded[i], []string{word})
+		}
+	}
+	return expanded
+}
+
+// sortedBySimilarity возвращает слова similar по возрастанию числа опечаток.
+func sortedBySimilarity(similar map[string]int) []string {
+	words := make([]string, 0, len(similar))
+	for word := range similar {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(a, b int) bool {
+		if similar[words[a]] != similar[words[b]] {
+			return similar[words[a]] < similar[words[b]]
+		}
+		return words[a] < words[b]
+	})
+	return words
+}
+
+// suggest возвращает до limit названий, слова которых начинаются со слов prefix.
+// Последнее слово prefix может быть недописанным; если точных совпадений
+// не хватает, в ход идут слова с опечатками. Выше стоят названия без опечаток,
+// затем названия, которые целиком начинаются с prefix, затем более короткие.
+func (index *fuzzyIndex) suggest(prefix string, limit int) []Suggestion {
+	words := strings.FieldsFunc(normalizeSearchText(prefix), isWordSeparator)
+	if len(words) == 0 || limit <= 0 {
+		return []Suggestion{}
+	}
+	last := words[len(words)-1]
+
+	// Сортировать все совпадения дорого: для короткого prefix их могут быть
+	// десятки тысяч. Лучшие limit названий отбираются вставкой.
+	whole := strings.Join(words, " ")
+	best := make([]suggestCandidate, 0, limit+1)
+	seen := make([]bool, len(index.names))
+	consider := func(n, typos int) {
+		if seen[n] {
+			return
+		}
+		seen[n] = true
+		extra, ok := matchWords(index.nameWords[n], words[:len(words)-1])
+		if !ok {
+			return
+		}
+		c := suggestCandidate{n: n, typos: typos + extra, prefix: strings.HasPrefix(index.nameTexts[n], whole)}
+		if len(best) == limit && !c.better(best[limit-1], index) {
+			return
+		}
+		i := sort.Search(len(best), func(i int) bool { return c.better(best[i], index) })
+		best = append(best, suggestCandidate{})
+		copy(best[i+1:], best[i:])
+		best[i] = c
+		if len(best) > limit {
+			best = best[:limit]
+		}
+	}
+
+	from, to := index.prefixRange(last)
+	for _, word := range index.words[from:to] {
+		for _, n := range index.byWord[word] {
+			consider(n, 0)
+		}
+	}
+	if len(best) < limit {
+		// Слова с меньшим числом опечаток рассматриваются раньше, поэтому
+		// название получает наименьшее число опечаток среди своих слов
+		similar := index.similar(last)
+		for _, word := range sortedBySimilarity(similar) {
+			for _, n := range index.byWord[word] {
+				consider(n, similar[word])
+			}
+		}
+	}
+
+	suggestions := make([]Suggestion, len(best))
+	for i, c := range best {
+		suggestions[i] = index.names[c.n]
+	}
+	return suggestions
+}
+
+type suggestCandidate struct {
+	n, typos int
+	// prefix — название целиком начинается с запроса
+	prefix bool
+}
+
+// better сравнивает подсказки: сначала меньше опечаток, затем названия, которые
+// начинаются с запроса, затем более короткие и по алфавиту.
+func (c suggestCandidate) better(other suggestCandidate, index *fuzzyIndex) bool {
+	if c.typos != other.typos {
+		return c.typos < other.typos
+	}
+	if c.prefix != other.prefix {
+		return c.prefix
+	}
+	if la, lb := index.nameLengths[c.n], index.nameLengths[other.n]; la != lb {
+		return la < lb
+	}
+	if a, b := index.names[c.n].Name, index.names[other.n].Name; a != b {
+		return a < b
+	}
+	return c.n < other.n
+}
+
+// matchWords проверяет, что каждое слово words с допустимыми опечатками
+// является началом одного из слов nameWords, и возвращает общее число опечаток.
+func matchWords(nameWords, words []string) (int, bool) {
+	var d prefixDistance
+	total := 0
+	for _, word := range words {
+		w := []rune(word)
+		limit := typoLimit(len(w))
+		best := limit + 1
+		for _, nameWord := range nameWords {
+			if n := d.distance(w, []rune(nameWord), limit); n < best {
+				best = n
+			}
+		}
+		if best > limit {
+			return 0, false
+		}
+		total += best
+	}
+	return total, true
+}
+
+// prefixDistance считает расстояние Дамерау — Левенштейна от слова до ближайшего
+// начала другого слова. Строки таблицы переиспользуются между вызовами.
+type prefixDistance struct {
+	prev2, prev, cur []int
+}
+
+// distance возвращает наименьшее число вставок, удалений, замен и перестановок
+// соседних букв, превращающих p в начало word, или limit+1, если их нужно больше limit.
+func (d *prefixDistance) distance(p, word []rune, limit int) int {
+	// Начало word длиннее p больше чем на limit букв заведомо слишком далеко
+	if len(word) > len(p)+limit {
+		word = word[:len(p)+limit]
+	}
+	width := len(word) + 1
+	if cap(d.cur) < width {
+		d.prev2, d.prev, d.cur = make([]int, width), make([]int, width), make([]int, width)
+	}
+	prev2, prev, cur := d.prev2[:width], d.prev[:width], d.cur[:width]
+
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(p); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j < width; j++ {
+			cost := 1
+			if p[i-1] == word[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && p[i-1] == word[j-2] && p[i-2] == word[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	best := limit + 1
+	for _, n := range prev {
+		best = min(best, n)
+	}
+	return best
+}
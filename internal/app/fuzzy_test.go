@@ -0,0 +1,218 @@
+package app
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTypoLimit(t *testing.T) {
+	tests := []struct {
+		word string
+		want int
+	}{
+		{"ко", 0},
+		{"кот", 1},
+		{"кофе", 1},
+		{"книга", 1},
+		{"магазин", 2},
+	}
+	for _, tt := range tests {
+		if got := typoLimit(len([]rune(tt.word))); got != tt.want {
+			t.Errorf("typoLimit(%q) = %d, ожидается %d", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestPrefixDistance(t *testing.T) {
+	tests := []struct {
+		prefix, word string
+		limit, want  int
+	}{
+		{"маг", "магазин", 1, 0},
+		{"мгаз", "магазин", 2, 1},    // перестановка соседних букв — одна опечатка
+		{"магизин", "магазин", 2, 1}, // замена
+		{"магазн", "магазин", 2, 1},  // пропуск
+		{"маагазин", "магазин", 2, 1},
+		{"мкгпзин", "магазин", 2, 2},
+		{"книга", "магазин", 2, 3}, // больше limit — limit+1
+	}
+	var d prefixDistance
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			if got := d.distance([]rune(tt.prefix), []rune(tt.word), tt.limit); got != tt.want {
+				t.Errorf("distance(%q, %q) = %d, ожидается %d", tt.prefix, tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func testFuzzyIndex() *fuzzyIndex {
+	return newFuzzyIndex([]Shop{
+		{ID: 1, Name: "Кофейня Бодрое утро", Description: "Свежий кофе и выпечка"},
+		{ID: 2, Name: "Книжный магазин Буква", Description: "Книги и журналы"},
+		{ID: 3, Name: "Магазин цветов", Description: "Букеты и доставка"},
+		{ID: 4, Name: "Магазин", Description: "Всё для дома"},
+	}, []Category{
+		{ID: 1, Name: "Магазины у дома"},
+		{ID: 2, Name: "Кофе"},
+	})
+}
+
+func TestFuzzyIndexExpand(t *testing.T) {
+	index := testFuzzyIndex()
+	tests := []struct {
+		word string
+		// want — слово, которое должно попасть в варианты; пусто — вариантов нет
+		want string
+	}{
+		{"магизин", "магазин"},
+		{"выпечкв", "выпечка"},
+		{"буект", "букеты"},
+		// Слово есть в словаре — исправлять нечего
+		{"магазин", ""},
+		// Слова из двух букв не исправляются
+		{"кф", ""},
+		{"зщзщзщ", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			term := index.expand([]searchTerm{{{tt.word}}})[0]
+			var corrections []string
+			for _, alternative := range term[1:] {
+				corrections = append(corrections, alternative...)
+			}
+			if tt.want == "" {
+				if len(corrections) > 0 {
+					t.Errorf("исправления %q, ожидается ни одного", corrections)
+				}
+				return
+			}
+			found := false
+			for _, word := range corrections {
+				found = found || word == tt.want
+			}
+			if !found {
+				t.Errorf("исправления %q не содержат %q", corrections, tt.want)
+			}
+		})
+	}
+}
+
+func TestFuzzyIndexSuggest(t *testing.T) {
+	index := testFuzzyIndex()
+	tests := []struct {
+		prefix string
+		limit  int
+		want   []Suggestion
+	}{
+		{
+			// Без опечаток выше названия, начинающиеся с запроса, затем более короткие
+			prefix: "маг",
+			limit:  10,
+			want: []Suggestion{
+				{Type: "shop", ID: 4, Name: "Магазин"},
+				{Type: "shop", ID: 3, Name: "Магазин цветов"},
+				{Type: "category", ID: 1, Name: "Магазины у дома"},
+				{Type: "shop", ID: 2, Name: "Книжный магазин Буква"},
+			},
+		},
+		{prefix: "маг", limit: 2, want: []Suggestion{{Type: "shop", ID: 4, Name: "Магазин"}, {Type: "shop", ID: 3, Name: "Магазин цветов"}}},
+		{prefix: "книжн маг", limit: 10, want: []Suggestion{{Type: "shop", ID: 2, Name: "Книжный магазин Буква"}}},
+		{prefix: "Кофе", limit: 10, want: []Suggestion{{Type: "category", ID: 2, Name: "Кофе"}, {Type: "shop", ID: 1, Name: "Кофейня Бодрое утро"}}},
+		// С опечаткой
+		{prefix: "мгазин цв", limit: 10, want: []Suggestion{{Type: "shop", ID: 3, Name: "Магазин цветов"}}},
+		{prefix: "букав", limit: 10, want: []Suggestion{{Type: "shop", ID: 2, Name: "Книжный магазин Буква"}}},
+		{prefix: "", limit: 10, want: []Suggestion{}},
+		{prefix: "электроника", limit: 10, want: []Suggestion{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			got := index.suggest(tt.prefix, tt.limit)
+			if len(got) != len(tt.want) {
+				t.Fatalf("подсказки %v, ожидаются %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("подсказка %d: %v, ожидается %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFuzzyCache(t *testing.T) {
+	var c fuzzyCache
+	var builds atomic.Int32
+	release := make(chan struct{})
+	prepare := func(shops []Shop, wait bool) func() func() (*fuzzyIndex, error) {
+		return func() func() (*fuzzyIndex, error) {
+			return func() (*fuzzyIndex, error) {
+				builds.Add(1)
+				if wait {
+					<-release
+				}
+				return newFuzzyIndex(shops, nil), nil
+			}
+		}
+	}
+	first := []Shop{{ID: 1, Name: "Магазин"}}
+	second := []Shop{{ID: 1, Name: "Магазин"}, {ID: 2, Name: "Пекарня"}}
+
+	// Первый индекс строится сразу
+	index, err := c.get(1, prepare(first, false))
+	if err != nil || len(index.names) != 1 {
+		t.Fatalf("первый индекс: %v, %v", index, err)
+	}
+
+	// После изменения данных запросы получают прежний индекс, пока новый строится
+	for i := 0; i < 3; i++ {
+		index, _ = c.get(2, prepare(second, true))
+		if len(index.names) != 1 {
+			t.Fatalf("во время построения возвращён индекс из %d названий, ожидается прежний", len(index.names))
+		}
+	}
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		index, _ = c.get(2, prepare(second, false))
+		if len(index.names) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("новый индекс так и не появился")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Одно построение при запуске и одно фоновое, несмотря на несколько запросов
+	if n := builds.Load(); n != 2 {
+		t.Errorf("индекс строился %d раз, ожидается 2", n)
+	}
+}
+
+func TestFuzzyCacheKeepsIndexOnError(t *testing.T) {
+	var c fuzzyCache
+	c.get(1, func() func() (*fuzzyIndex, error) {
+		return func() (*fuzzyIndex, error) { return newFuzzyIndex([]Shop{{ID: 1, Name: "Магазин"}}, nil), nil }
+	})
+
+	done := make(chan struct{})
+	index, err := c.get(2, func() func() (*fuzzyIndex, error) {
+		return func() (*fuzzyIndex, error) {
+			defer close(done)
+			return nil, errors.New("база данных недоступна")
+		}
+	})
+	if err != nil || len(index.names) != 1 {
+		t.Fatalf("получено %v, %v, ожидается прежний индекс", index, err)
+	}
+	<-done
+	for c.building.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	if s := c.current.Load(); s.generation != 1 || len(s.index.names) != 1 {
+		t.Errorf("после ошибки индекс заменён: поколение %d", s.generation)
+	}
+}
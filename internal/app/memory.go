@@ -0,0 +1,820 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemoryStore — хранилище в памяти процесса с той же семантикой, что и App:
+// каскадное удаление связей и проверка внешних ключей при привязке категорий.
+// Контекст в методах не используется: операции в памяти не ждут ввода-вывода.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	shops      map[int]Shop
+	categories map[int]Category
+	// links хранит связи магазин -> множество категорий
+	links map[int]map[int]struct{}
+
+	nextShopID     int
+	nextCategoryID int
+
+	// generation растёт при каждом изменении магазинов и категорий,
+	// по нему перестраивается индекс опечаток fuzzy
+	generation int64
+	fuzzy      fuzzyCache
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		shops:          make(map[int]Shop),
+		categories:     make(map[int]Category),
+		links:          make(map[int]map[int]struct{}),
+		nextShopID:     1,
+		nextCategoryID: 1,
+	}
+}
+
+// Метод для добавления одной категории
+func (m *MemoryStore) InsertCategory(name string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextCategoryID
+	m.nextCategoryID++
+	m.categories[id] = Category{ID: id, Name: name}
+	m.generation++
+	return id
+}
+
+// Метод для добавления нескольких категорий
+func (m *MemoryStore) InsertSampleCategories() {
+	m.InsertCategory("Категория 1")
+	m.InsertCategory("Категория 2")
+	m.InsertCategory("Категория 3")
+	m.InsertCategory("Категория 4")
+	m.InsertCategory("Категория 5")
+	m.InsertCategory("Категория 6")
+}
+
+func (m *MemoryStore) GetShops(ctx context.Context, params ShopListParams) (Page[ShopWithCategories], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.shopPage(m.shopIDs(), params)
+}
+
+func (m *MemoryStore) GetShopsByIDs(ctx context.Context, ids []int) ([]ShopWithCategories, error) {
+	ids, err := uniqueBatchIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	found := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := m.shops[id]; ok {
+			found = append(found, id)
+		}
+	}
+	sort.Ints(found)
+	page, err := m.shopPage(found, ShopListParams{Limit: len(ids) + 1})
+	if err != nil {
+		return nil, err
+	}
+	return orderByIDs(page.Items, ids), nil
+}
+
+func (m *MemoryStore) GetShopByID(ctx context.Context, id int) (ShopWithCategories, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.shops[id]; !ok {
+		return ShopWithCategories{}, ErrShopNotFound
+	}
+	page, err := m.shopPage([]int{id}, ShopListParams{Limit: 1})
+	if err != nil {
+		return ShopWithCategories{}, err
+	}
+	return page.Items[0], nil
+}
+
+func (m *MemoryStore) SearchShops(ctx context.Context, params ShopSearchParams) (Page[ShopWithCategories], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	items, ok := m.searchItems(params.Query)
+	if !ok {
+		return Page[ShopWithCategories]{Items: []ShopWithCategories{}}, nil
+	}
+	return m.page(items, params.ShopListParams, true)
+}
+
+// searchItems возвращает магазины, подходящие под запрос query, с релевантностью
+// и подсветкой. ok = false, если в запросе нет ни одного слова.
+func (m *MemoryStore) searchItems(query string) (items []ShopWithCategories, ok bool) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, false
+	}
+
+	terms = m.fuzzyIndex().expand(terms)
+	for _, id := range m.shopIDs() {
+		rank, highlight, ok := matchShop(m.shops[id], terms)
+		if !ok {
+			continue
+		}
+		items = append(items, ShopWithCategories{Shop: m.shops[id], Rank: rank, Highlight: &highlight})
+	}
+	return items, true
+}
+
+func (m *MemoryStore) GetShopFacets(ctx context.Context, params FacetParams) (ShopFacets, error) {
+	if err := params.validate(); err != nil {
+		return ShopFacets{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var shops []Shop
+	if params.Query != "" {
+		items, _ := m.searchItems(params.Query)
+		for _, item := range items {
+			shops = append(shops, item.Shop)
+		}
+	} else {
+		for _, id := range m.shopIDs() {
+			shops = append(shops, m.shops[id])
+		}
+	}
+
+	buckets := params.buckets()
+	categoryParams, priceParams := params.categoryParams(), params.priceParams()
+	categoryMatch, priceMatch := categoryParams.Categories.matcher(m.subtree), priceParams.Categories.matcher(m.subtree)
+	facets := ShopFacets{Categories: []CategoryFacet{}, Prices: newPriceFacets(buckets)}
+	counts := make(map[int]int)
+	for _, shop := range shops {
+		linked := m.links[shop.ID]
+		if categoryParams.inPriceRange(shop.Price) && categoryMatch(linked) {
+			for categoryID := range linked {
+				counts[categoryID]++
+			}
+		}
+		if priceMatch(linked) {
+			facets.Prices[priceBucket(buckets, shop.Price)].Count++
+		}
+	}
+	for _, id := range m.categoryIDs() {
+		facets.Categories = append(facets.Categories, CategoryFacet{ID: id, Name: m.categories[id].Name, Count: counts[id]})
+	}
+	return facets, nil
+}
+
+func (m *MemoryStore) Suggest(ctx context.Context, prefix string, limit int) ([]Suggestion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.fuzzyIndex().suggest(prefix, limit), nil
+}
+
+// fuzzyIndex возвращает индекс опечаток; вызывается под m.mu. Копия магазинов
+// и категорий снимается под блокировкой, а индекс по ней строится уже без неё.
+func (m *MemoryStore) fuzzyIndex() *fuzzyIndex {
+	index, _ := m.fuzzy.get(m.generation, func() func() (*fuzzyIndex, error) {
+		shops := make([]Shop, 0, len(m.shops))
+		for _, id := range m.shopIDs() {
+			shops = append(shops, m.shops[id])
+		}
+		categories := make([]Category, 0, len(m.categories))
+		for _, category := range m.categories {
+			categories = append(categories, category)
+		}
+		sort.Slice(categories, func(i, j int) bool { return categories[i].ID < categories[j].ID })
+		return func() (*fuzzyIndex, error) {
+			return newFuzzyIndex(shops, categories), nil
+		}
+	})
+	return index
+}
+
+func (m *MemoryStore) CreateNewShop(ctx context.Context, shop Shop) (int, error) {
+	return m.CreateShop(ctx, shop, nil)
+}
+
+func (m *MemoryStore) CreateShop(ctx context.Context, shop Shop, categoryIDs []int) (int, error) {
+	shop = normalizeShop(shop)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.validateShop(shop, nil, categoryIDs); err != nil {
+		return 0, err
+	}
+
+	shop.ID = m.nextShopID
+	m.nextShopID++
+	m.shops[shop.ID] = shop
+	m.generation++
+	m.link(shop.ID, categoryIDs)
+	return shop.ID, nil
+}
+
+func (m *MemoryStore) ReplaceShop(ctx context.Context, id string, shop Shop, categoryIDs []int) error {
+	shopID, err := parseID(id)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении магазина: %w", err)
+	}
+	shop = normalizeShop(shop)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.validateShop(shop, nil, categoryIDs); err != nil {
+		return err
+	}
+	if _, ok := m.shops[shopID]; !ok {
+		return ErrShopNotFound
+	}
+
+	shop.ID = shopID
+	m.shops[shopID] = shop
+	m.generation++
+	delete(m.links, shopID)
+	m.link(shopID, categoryIDs)
+	return nil
+}
+
+func (m *MemoryStore) PatchShop(ctx context.Context, id string, fields map[string]interface{}, categoryIDs []int) error {
+	shopID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	return m.ApplyShopPatch(ctx, shopID, func(ShopWithCategories) (ShopPatch, error) {
+		return ShopPatch{Fields: fields, CategoryIDs: categoryIDs}, nil
+	})
+}
+
+func (m *MemoryStore) ApplyShopPatch(ctx context.Context, id int, patch func(current ShopWithCategories) (ShopPatch, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.shops[id]; !ok {
+		return ErrShopNotFound
+	}
+	current, err := m.shopPage([]int{id}, ShopListParams{Limit: 1})
+	if err != nil {
+		return err
+	}
+
+	changes, err := patch(current.Items[0])
+	if err != nil {
+		return err
+	}
+	fields, err := checkShopFields(changes.Fields)
+	if err != nil {
+		return err
+	}
+	shop := m.shops[id]
+	setShopFields(&shop, fields)
+	if err := m.validateShop(shop, fields, changes.CategoryIDs); err != nil {
+		return err
+	}
+
+	// Все проверки пройдены, изменяем данные
+	m.shops[id] = shop
+	m.generation++
+	if changes.CategoryIDs != nil {
+		delete(m.links, id)
+		m.link(id, changes.CategoryIDs)
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteShopByID(ctx context.Context, id string) error {
+	shopID, err := parseID(id)
+	if err != nil {
+		return fmt.Errorf("ошибка при удалении магазина: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.shops[shopID]; !ok {
+		return ErrShopNotFound
+	}
+	// Связи удаляются каскадно вместе с магазином
+	delete(m.shops, shopID)
+	m.generation++
+	delete(m.links, shopID)
+	return nil
+}
+
+func (m *MemoryStore) UpdateShopByID(ctx context.Context, id string, updatedShop Shop) error {
+	shopID, err := parseID(id)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении магазина: %w", err)
+	}
+	updatedShop = normalizeShop(updatedShop)
+	if err := validateShop(updatedShop, nil, nil, nil); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.shops[shopID]; !ok {
+		return ErrShopNotFound
+	}
+	updatedShop.ID = shopID
+	m.shops[shopID] = updatedShop
+	m.generation++
+	return nil
+}
+
+func (m *MemoryStore) UpdateShopFields(ctx context.Context, id string, fields map[string]interface{}) error {
+	shopID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	shop, ok := m.shops[shopID]
+	if !ok {
+		return ErrShopNotFound
+	}
+	// Сначала проверяем все поля, чтобы не изменить магазин частично
+	checked, err := checkShopFields(fields)
+	if err != nil {
+		return err
+	}
+	setShopFields(&shop, checked)
+	if err := m.validateShop(shop, checked, nil); err != nil {
+		return err
+	}
+	m.shops[shopID] = shop
+	m.generation++
+	return nil
+}
+
+func (m *MemoryStore) AddShopCategories(ctx context.Context, shopID int, categoryIDs []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Проверяем все связи до изменения данных, как это делает транзакция
+	pending := make(map[int]struct{}, len(categoryIDs))
+	for _, categoryID := range categoryIDs {
+		err := m.checkLink(shopID, categoryID)
+		if err == nil {
+			if _, ok := pending[categoryID]; ok {
+				err = ErrShopCategoryExists
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка при добавлении категории %d для магазина %d: %w", categoryID, shopID, err)
+		}
+		pending[categoryID] = struct{}{}
+	}
+
+	m.link(shopID, categoryIDs)
+	return nil
+}
+
+func (m *MemoryStore) UpdateShopCategories(ctx context.Context, shopID string, categoryIDs []int) error {
+	id, err := parseID(shopID)
+	if err != nil {
+		return fmt.Errorf("не удалось удалить старые категории: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.shops[id]; !ok {
+		return ErrShopNotFound
+	}
+
+	// Старые связи не учитываются при проверке, так как они будут заменены.
+	// Пустой список полей: проверяются только категории
+	if err := m.validateShop(Shop{}, map[string]interface{}{}, categoryIDs); err != nil {
+		return err
+	}
+
+	delete(m.links, id)
+	m.link(id, categoryIDs)
+	return nil
+}
+
+func (m *MemoryStore) GetCategoriesByShopID(ctx context.Context, shopID int) ([]Category, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.shops[shopID]; !ok {
+		return nil, ErrShopNotFound
+	}
+	categories := []Category{}
+	for _, id := range m.linkedCategoryIDs(shopID) {
+		categories = append(categories, m.categories[id])
+	}
+	return categories, nil
+}
+
+func (m *MemoryStore) LinkShopCategory(ctx context.Context, shopID, categoryID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.shops[shopID]; !ok {
+		return ErrShopNotFound
+	}
+	if _, ok := m.categories[categoryID]; !ok {
+		return ErrCategoryNotFound
+	}
+	m.link(shopID, []int{categoryID})
+	return nil
+}
+
+func (m *MemoryStore) UnlinkShopCategory(ctx context.Context, shopID, categoryID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.links[shopID][categoryID]; !ok {
+		return ErrShopCategoryNotFound
+	}
+	delete(m.links[shopID], categoryID)
+	if len(m.links[shopID]) == 0 {
+		delete(m.links, shopID)
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetCategories(ctx context.Context, limit, offset int) (Page[Category], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := checkOffset(offset); err != nil {
+		return Page[Category]{}, err
+	}
+	limit = pageLimit(limit)
+
+	ids := m.categoryIDs()
+	page := Page[Category]{Items: []Category{}, Total: len(ids)}
+	for _, id := range paginate(ids, limit, offset) {
+		page.Items = append(page.Items, m.categories[id])
+	}
+	return page, nil
+}
+
+func (m *MemoryStore) GetCategoryByID(ctx context.Context, id int) (Category, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	category, ok := m.categories[id]
+	if !ok {
+		return Category{}, ErrCategoryNotFound
+	}
+	return category, nil
+}
+
+func (m *MemoryStore) CreateCategory(ctx context.Context, name string, parentID *int) (Category, error) {
+	name, err := normalizeCategoryName(name)
+	if err != nil {
+		return Category{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkCategoryParent(0, parentID); err != nil {
+		return Category{}, err
+	}
+	if m.categoryNameTaken(name, 0) {
+		return Category{}, ErrCategoryExists
+	}
+	category := Category{ID: m.nextCategoryID, Name: name, ParentID: parentID}
+	m.nextCategoryID++
+	m.categories[category.ID] = category
+	m.generation++
+	return category, nil
+}
+
+func (m *MemoryStore) UpdateCategory(ctx context.Context, id int, update CategoryUpdate) (Category, error) {
+	var name string
+	if update.Name != nil {
+		var err error
+		if name, err = normalizeCategoryName(*update.Name); err != nil {
+			return Category{}, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	category, ok := m.categories[id]
+	if !ok {
+		return Category{}, ErrCategoryNotFound
+	}
+	if update.SetParent {
+		if err := m.checkCategoryParent(id, update.ParentID); err != nil {
+			return Category{}, err
+		}
+		category.ParentID = update.ParentID
+	}
+	if update.Name != nil {
+		if m.categoryNameTaken(name, id) {
+			return Category{}, ErrCategoryExists
+		}
+		category.Name = name
+	}
+	m.categories[id] = category
+	m.generation++
+	return category, nil
+}
+
+func (m *MemoryStore) DeleteCategory(ctx context.Context, id int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.categories[id]; !ok {
+		return 0, ErrCategoryNotFound
+	}
+	for _, category := range m.categories {
+		if category.ParentID != nil && *category.ParentID == id {
+			return 0, ErrCategoryHasChildren
+		}
+	}
+	delete(m.categories, id)
+	m.generation++
+
+	// Связи с магазинами удаляются каскадно
+	links := 0
+	for shopID, categories := range m.links {
+		if _, ok := categories[id]; ok {
+			delete(categories, id)
+			links++
+		}
+		if len(categories) == 0 {
+			delete(m.links, shopID)
+		}
+	}
+	return links, nil
+}
+
+func (m *MemoryStore) GetCategoryStats(ctx context.Context, recent int) ([]CategoryStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	shops := make(map[int][]Shop)
+	for _, shopID := range m.shopIDs() {
+		for categoryID := range m.links[shopID] {
+			shops[categoryID] = append(shops[categoryID], m.shops[shopID])
+		}
+	}
+
+	stats := []CategoryStats{}
+	for _, id := range m.categoryIDs() {
+		stats = append(stats, categoryStats(m.categories[id], shops[id], recent))
+	}
+	return stats, nil
+}
+
+func (m *MemoryStore) GetCategoryTree(ctx context.Context) ([]CategoryNode, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	categories := make([]Category, 0, len(m.categories))
+	for _, id := range m.categoryIDs() {
+		categories = append(categories, m.categories[id])
+	}
+	return buildCategoryTree(categories), nil
+}
+
+func (m *MemoryStore) GetCategoryPath(ctx context.Context, id int) ([]Category, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	category, ok := m.categories[id]
+	if !ok {
+		return nil, ErrCategoryNotFound
+	}
+	// Подъём останавливается на повторной категории, если в данных окажется цикл
+	path := []Category{category}
+	visited := map[int]bool{id: true}
+	for category.ParentID != nil && !visited[*category.ParentID] {
+		category, ok = m.categories[*category.ParentID]
+		if !ok {
+			break
+		}
+		visited[category.ID] = true
+		path = append([]Category{category}, path...)
+	}
+	return path, nil
+}
+
+func (m *MemoryStore) GetShopCategories(ctx context.Context) ([]ShopCategory, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var shopCategories []ShopCategory
+	for _, shopID := range m.shopIDs() {
+		for _, categoryID := range m.linkedCategoryIDs(shopID) {
+			shopCategories = append(shopCategories, ShopCategory{ShopID: shopID, CategoryID: categoryID})
+		}
+	}
+	return shopCategories, nil
+}
+
+// shopPage строит страницу из магазинов ids.
+func (m *MemoryStore) shopPage(ids []int, params ShopListParams) (Page[ShopWithCategories], error) {
+	items := make([]ShopWithCategories, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, ShopWithCategories{Shop: m.shops[id]})
+	}
+	return m.page(items, params, false)
+}
+
+// page отбирает из items магазины в диапазоне цен и по категориям, упорядочивает их и возвращает
+// страницу. Категории заполняются только у магазинов страницы.
+func (m *MemoryStore) page(items []ShopWithCategories, params ShopListParams, search bool) (Page[ShopWithCategories], error) {
+	page := Page[ShopWithCategories]{Items: []ShopWithCategories{}}
+
+	bounds, err := params.bounds(search)
+	if err != nil {
+		return page, err
+	}
+
+	match := params.Categories.matcher(m.subtree)
+	filtered := items[:0]
+	for _, item := range items {
+		if params.inPriceRange(item.Shop.Price) && match(m.links[item.Shop.ID]) {
+			filtered = append(filtered, item)
+		}
+	}
+	items = filtered
+	page.Total = len(items)
+
+	sort.Slice(items, func(i, j int) bool { return compareShops(items[i], items[j], bounds.order) < 0 })
+	if bounds.after != nil {
+		items = items[sort.Search(len(items), func(i int) bool {
+			return compareShopKey(items[i], bounds.after, bounds.order) > 0
+		}):]
+	}
+
+	if bounds.offset >= len(items) {
+		return page, nil
+	}
+	items = items[bounds.offset:]
+	if len(items) > bounds.limit {
+		page.NextCursor = nextShopCursor(items[bounds.limit-1], bounds.order)
+		items = items[:bounds.limit]
+	}
+	for _, item := range items {
+		full := m.shopItem(item.Shop.ID)
+		full.Rank, full.Highlight = item.Rank, item.Highlight
+		page.Items = append(page.Items, full)
+	}
+	return page, nil
+}
+
+// shopItem возвращает магазин вместе с его категориями.
+func (m *MemoryStore) shopItem(id int) ShopWithCategories {
+	item := ShopWithCategories{Shop: m.shops[id], Categories: []Category{}}
+	for _, categoryID := range m.linkedCategoryIDs(id) {
+		item.Categories = append(item.Categories, m.categories[categoryID])
+	}
+	return item
+}
+
+// categoryIDs возвращает идентификаторы категорий по возрастанию.
+func (m *MemoryStore) categoryIDs() []int {
+	ids := make([]int, 0, len(m.categories))
+	for id := range m.categories {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// checkCategoryParent повторяет checkCategoryParent из App: родитель существует
+// и не является самой категорией id или её подкатегорией.
+func (m *MemoryStore) checkCategoryParent(id int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	_, exists := m.categories[*parentID]
+	cycle := false
+	visited := make(map[int]bool)
+	for ancestor := parentID; exists && ancestor != nil && !cycle && !visited[*ancestor]; ancestor = m.categories[*ancestor].ParentID {
+		visited[*ancestor] = true
+		cycle = *ancestor == id
+	}
+	return parentErrors(*parentID, exists, cycle)
+}
+
+// subtree возвращает категорию id вместе со всеми подкатегориями.
+func (m *MemoryStore) subtree(id int) []int {
+	children := make(map[int][]int)
+	for _, category := range m.categories {
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category.ID)
+		}
+	}
+	ids := []int{id}
+	visited := map[int]bool{id: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !visited[child] {
+				visited[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids
+}
+
+// categoryNameTaken повторяет уникальный индекс categories_name_key.
+func (m *MemoryStore) categoryNameTaken(name string, exceptID int) bool {
+	for id, category := range m.categories {
+		if id != exceptID && category.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// shopIDs возвращает идентификаторы магазинов по возрастанию.
+func (m *MemoryStore) shopIDs() []int {
+	ids := make([]int, 0, len(m.shops))
+	for id := range m.shops {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// linkedCategoryIDs возвращает категории магазина по возрастанию.
+func (m *MemoryStore) linkedCategoryIDs(shopID int) []int {
+	ids := make([]int, 0, len(m.links[shopID]))
+	for id := range m.links[shopID] {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// checkForeignKeys повторяет ограничения FOREIGN KEY таблицы shop_categories.
+func (m *MemoryStore) checkForeignKeys(shopID, categoryID int) error {
+	if _, ok := m.shops[shopID]; !ok {
+		return ErrShopNotFound
+	}
+	if _, ok := m.categories[categoryID]; !ok {
+		return newForeignKeyError(categoryID)
+	}
+	return nil
+}
+
+// validateShop проверяет магазин и существование его категорий.
+func (m *MemoryStore) validateShop(shop Shop, fields map[string]interface{}, categoryIDs []int) error {
+	existing := make(map[int]bool, len(categoryIDs))
+	for _, id := range categoryIDs {
+		_, existing[id] = m.categories[id]
+	}
+	return validateShop(shop, fields, categoryIDs, existing)
+}
+
+// checkLink дополнительно проверяет PRIMARY KEY (shop_id, category_id).
+func (m *MemoryStore) checkLink(shopID, categoryID int) error {
+	if err := m.checkForeignKeys(shopID, categoryID); err != nil {
+		return err
+	}
+	if _, ok := m.links[shopID][categoryID]; ok {
+		return ErrShopCategoryExists
+	}
+	return nil
+}
+
+func (m *MemoryStore) link(shopID int, categoryIDs []int) {
+	if len(categoryIDs) == 0 {
+		return
+	}
+	if m.links[shopID] == nil {
+		m.links[shopID] = make(map[int]struct{}, len(categoryIDs))
+	}
+	for _, categoryID := range categoryIDs {
+		m.links[shopID][categoryID] = struct{}{}
+	}
+}
+
+func paginate(ids []int, limit, offset int) []int {
+	if offset >= len(ids) {
+		return nil
+	}
+	ids = ids[offset:]
+	if limit < len(ids) {
+		ids = ids[:limit]
+	}
+	return ids
+}
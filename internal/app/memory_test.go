@@ -0,0 +1,330 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// newTestMemoryStore возвращает хранилище с категориями 1–6 и магазинами:
+// 1 — в категориях 1 и 2, 2 — в категориях 2 и 3, 3 — без категорий.
+func newTestMemoryStore(t *testing.T) *MemoryStore {
+	t.Helper()
+	m := NewMemoryStore()
+	m.InsertSampleCategories()
+	for _, shop := range []struct {
+		name       string
+		categories []int
+	}{
+		{"Пекарня", []int{1, 2}},
+		{"Книжный", []int{2, 3}},
+		{"Цветы", nil},
+	} {
+		if _, err := m.CreateShop(context.Background(), Shop{Name: shop.name, Image: "shop.jpg", Price: 100}, shop.categories); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+// links возвращает связи хранилища в виде пар «магазин: категория».
+func links(t *testing.T, m *MemoryStore) []ShopCategory {
+	t.Helper()
+	links, err := m.GetShopCategories(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return links
+}
+
+func equalLinks(a, b []ShopCategory) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMemoryStoreDeleteCascade(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("магазин", func(t *testing.T) {
+		m := newTestMemoryStore(t)
+		if err := m.DeleteShopByID(ctx, "1"); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := links(t, m), []ShopCategory{{2, 2}, {2, 3}}; !equalLinks(got, want) {
+			t.Errorf("связи %v, ожидаются %v", got, want)
+		}
+		if err := m.DeleteShopByID(ctx, "1"); !errors.Is(err, ErrShopNotFound) {
+			t.Errorf("повторное удаление: %v, ожидается %v", err, ErrShopNotFound)
+		}
+		// Новый магазин не наследует связи удалённого
+		id, err := m.CreateShop(ctx, Shop{Name: "Новый", Image: "shop.jpg", Price: 1}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if categories, _ := m.GetCategoriesByShopID(ctx, id); len(categories) != 0 {
+			t.Errorf("у нового магазина категории %v", categories)
+		}
+	})
+
+	t.Run("категория", func(t *testing.T) {
+		m := newTestMemoryStore(t)
+		removed, err := m.DeleteCategory(ctx, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if removed != 2 {
+			t.Errorf("удалено связей %d, ожидается 2", removed)
+		}
+		if got, want := links(t, m), []ShopCategory{{1, 1}, {2, 3}}; !equalLinks(got, want) {
+			t.Errorf("связи %v, ожидаются %v", got, want)
+		}
+		if _, err := m.DeleteCategory(ctx, 2); !errors.Is(err, ErrCategoryNotFound) {
+			t.Errorf("повторное удаление: %v, ожидается %v", err, ErrCategoryNotFound)
+		}
+		// Без связей удаляется и ничего не затрагивает
+		if removed, err := m.DeleteCategory(ctx, 6); err != nil || removed != 0 {
+			t.Errorf("удаление категории без связей: %d, %v", removed, err)
+		}
+	})
+
+	t.Run("категория с подкатегориями", func(t *testing.T) {
+		m := newTestMemoryStore(t)
+		parent := 2
+		if _, err := m.CreateCategory(ctx, "Подкатегория", &parent); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.DeleteCategory(ctx, 2); !errors.Is(err, ErrCategoryHasChildren) {
+			t.Errorf("ошибка %v, ожидается %v", err, ErrCategoryHasChildren)
+		}
+		if got := links(t, m); len(got) != 4 {
+			t.Errorf("после отказа осталось %d связей, ожидается 4", len(got))
+		}
+	})
+}
+
+func TestMemoryStoreLinkChecks(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		link func(m *MemoryStore) error
+		kind Kind
+		code string
+		want []ShopCategory
+	}{
+		{
+			name: "привязка",
+			link: func(m *MemoryStore) error { return m.LinkShopCategory(ctx, 3, 4) },
+			want: []ShopCategory{{1, 1}, {1, 2}, {2, 2}, {2, 3}, {3, 4}},
+		},
+		{
+			name: "повторная привязка не ошибка",
+			link: func(m *MemoryStore) error { return m.LinkShopCategory(ctx, 1, 1) },
+			want: []ShopCategory{{1, 1}, {1, 2}, {2, 2}, {2, 3}},
+		},
+		{
+			name: "привязка к несуществующей категории",
+			link: func(m *MemoryStore) error { return m.LinkShopCategory(ctx, 1, 99) },
+			kind: KindNotFound,
+			code: "category_not_found",
+		},
+		{
+			name: "привязка несуществующего магазина",
+			link: func(m *MemoryStore) error { return m.LinkShopCategory(ctx, 99, 1) },
+			kind: KindNotFound,
+			code: "shop_not_found",
+		},
+		{
+			name: "добавление несуществующей категории",
+			link: func(m *MemoryStore) error { return m.AddShopCategories(ctx, 3, []int{4, 99}) },
+			kind: KindForeignKey,
+			code: "category_reference_invalid",
+		},
+		{
+			name: "добавление существующей связи",
+			link: func(m *MemoryStore) error { return m.AddShopCategories(ctx, 1, []int{4, 2}) },
+			kind: KindConflict,
+			code: "shop_category_exists",
+		},
+		{
+			name: "добавление повторяющихся категорий",
+			link: func(m *MemoryStore) error { return m.AddShopCategories(ctx, 3, []int{4, 4}) },
+			kind: KindConflict,
+			code: "shop_category_exists",
+		},
+		{
+			name: "замена набора с несуществующей категорией",
+			link: func(m *MemoryStore) error { return m.UpdateShopCategories(ctx, "1", []int{3, 99}) },
+			kind: KindValidation,
+			code: "validation_failed",
+		},
+		{
+			name: "отвязка",
+			link: func(m *MemoryStore) error { return m.UnlinkShopCategory(ctx, 1, 2) },
+			want: []ShopCategory{{1, 1}, {2, 2}, {2, 3}},
+		},
+		{
+			name: "отвязка несуществующей связи",
+			link: func(m *MemoryStore) error { return m.UnlinkShopCategory(ctx, 3, 1) },
+			kind: KindNotFound,
+			code: "shop_category_not_found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMemoryStore(t)
+			err := tt.link(m)
+
+			want := tt.want
+			if tt.code == "" {
+				if err != nil {
+					t.Fatalf("неожиданная ошибка: %v", err)
+				}
+			} else {
+				var appErr *Error
+				if !errors.As(err, &appErr) || appErr.Kind != tt.kind || appErr.Code != tt.code {
+					t.Fatalf("ошибка %v, ожидается %s", err, tt.code)
+				}
+				// При ошибке связи не меняются, даже частично
+				want = []ShopCategory{{1, 1}, {1, 2}, {2, 2}, {2, 3}}
+			}
+			if got := links(t, m); !equalLinks(got, want) {
+				t.Errorf("связи %v, ожидаются %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreMoveCategory(t *testing.T) {
+	ctx := context.Background()
+	parent := func(id int) CategoryUpdate { return CategoryUpdate{SetParent: true, ParentID: &id} }
+
+	// Дерево: 1 → 2 → 3, остальные категории корневые
+	newTree := func(t *testing.T) *MemoryStore {
+		m := newTestMemoryStore(t)
+		for _, move := range [][2]int{{2, 1}, {3, 2}} {
+			if _, err := m.UpdateCategory(ctx, move[0], parent(move[1])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return m
+	}
+
+	tests := []struct {
+		name   string
+		id     int
+		update CategoryUpdate
+		// field — код ошибки parent_id; пусто — перенос разрешён
+		field string
+		path  []int
+	}{
+		{"в другую ветку", 3, parent(4), "", []int{4, 3}},
+		{"в корень", 3, CategoryUpdate{SetParent: true}, "", []int{3}},
+		{"вместе с подкатегориями", 2, parent(5), "", []int{5, 2}},
+		{"только название", 3, CategoryUpdate{Name: strPtr("Переименована")}, "", []int{1, 2, 3}},
+		{"в саму себя", 2, parent(2), "cycle", []int{1, 2}},
+		{"в свою подкатегорию", 1, parent(3), "cycle", []int{1}},
+		{"в несуществующую категорию", 3, parent(99), "not_found", []int{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTree(t)
+			_, err := m.UpdateCategory(ctx, tt.id, tt.update)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("неожиданная ошибка: %v", err)
+				}
+			} else {
+				var appErr *Error
+				if !errors.As(err, &appErr) || len(appErr.Fields) != 1 || appErr.Fields[0].Field != "parent_id" || appErr.Fields[0].Code != tt.field {
+					t.Fatalf("ошибка %v, ожидается parent_id: %s", err, tt.field)
+				}
+			}
+
+			path, err := m.GetCategoryPath(ctx, tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, category := range path {
+				ids = append(ids, category.ID)
+			}
+			if !equalInts(ids, tt.path) {
+				t.Errorf("путь к категории %v, ожидается %v", ids, tt.path)
+			}
+		})
+	}
+
+	t.Run("подкатегории переезжают вместе с родителем", func(t *testing.T) {
+		m := newTree(t)
+		if _, err := m.UpdateCategory(ctx, 2, parent(6)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.CreateShop(ctx, Shop{Name: "Сушки", Image: "shop.jpg", Price: 1}, []int{3}); err != nil {
+			t.Fatal(err)
+		}
+		page, err := m.GetShops(ctx, ShopListParams{Limit: 10, Categories: CategoryFilter{IDs: []int{6}, Descendants: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for _, item := range page.Items {
+			ids = append(ids, item.Shop.ID)
+		}
+		// Пекарня и книжный — в категории 2, новый магазин — в её подкатегории 3
+		if !equalInts(ids, []int{1, 2, 4}) {
+			t.Errorf("в поддереве категории 6 магазины %v, ожидаются [1 2 4]", ids)
+		}
+	})
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestMemoryStoreCategoryCycle(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMemoryStore(t)
+	// Цикл 1 → 2 → 3 → 1 не создать через API, поэтому данные портятся напрямую
+	for child, parent := range map[int]int{1: 3, 2: 1, 3: 2} {
+		category := m.categories[child]
+		category.ParentID = &parent
+		m.categories[child] = category
+	}
+
+	path, err := m.GetCategoryPath(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, category := range path {
+		ids = append(ids, category.ID)
+	}
+	if !equalInts(ids, []int{1, 2, 3}) {
+		t.Errorf("путь к категории %v, ожидается [1 2 3]", ids)
+	}
+
+	if got := len(m.subtree(1)); got != 3 {
+		t.Errorf("в поддереве %d категорий, ожидается 3", got)
+	}
+	parent := 2
+	if _, err := m.UpdateCategory(ctx, 4, CategoryUpdate{SetParent: true, ParentID: &parent}); err != nil {
+		t.Errorf("перенос под категорию из цикла: %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationsFS embed.FS
+
+// migrationLockID — ключ advisory lock, под которым применяются миграции,
+// чтобы несколько экземпляров сервера не выполняли их одновременно.
+const migrationLockID = 7_281_034_155
+
+// migrationData — шаги миграций, которые нельзя записать на SQL, по именам миграций.
+// Шаг выполняется после SQL миграции вверх в той же транзакции.
+var migrationData = map[string]func(ctx context.Context, q querier) error{
+	"shop_translit": fillShopSearchForms,
+}
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// loadMigrations читает встроенные файлы вида 0001_name.up.sql / 0001_name.down.sql
+// и возвращает миграции, упорядоченные по версии.
+func loadMigrations(dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, dir)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения каталога миграций: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("некорректное имя файла миграции: %s", fileName)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("некорректная версия миграции %s: %v", fileName, err)
+		}
+
+		body, err := fs.ReadFile(migrationsFS, path.Join(dir, fileName))
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения миграции %s: %v", fileName, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("у миграции %d разные имена: %s и %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("у миграции %04d_%s нет файла up", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrateUp применяет все ещё не применённые миграции и возвращает их список.
+func (app *App) MigrateUp(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := app.withMigrationLock(ctx, func(conn *sql.Conn, migrations []Migration, current map[int]time.Time) error {
+		for _, m := range migrations {
+			if _, ok := current[m.Version]; ok {
+				continue
+			}
+			err := runMigration(ctx, conn, m.Up, migrationData[m.Name],
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("ошибка применения миграции %04d_%s: %v", m.Version, m.Name, err)
+			}
+			applied = append(applied, m)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown откатывает последние n применённых миграций.
+func (app *App) MigrateDown(ctx context.Context, n int) ([]Migration, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("количество откатываемых миграций должно быть положительным: %d", n)
+	}
+
+	var reverted []Migration
+	err := app.withMigrationLock(ctx, func(conn *sql.Conn, migrations []Migration, current map[int]time.Time) error {
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < n; i-- {
+			m := migrations[i]
+			if _, ok := current[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("миграция %04d_%s не поддерживает откат", m.Version, m.Name)
+			}
+			err := runMigration(ctx, conn, m.Down, nil,
+				`DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+			if err != nil {
+				return fmt.Errorf("ошибка отката миграции %04d_%s: %v", m.Version, m.Name, err)
+			}
+			reverted = append(reverted, m)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationStatus возвращает все известные миграции с отметкой о применении.
+// Состояние только читается, поэтому блокировка миграций не захватывается
+// и команда не ждёт завершения миграций, выполняемых в это время.
+func (app *App) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(app.dialect.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	// До первой миграции таблицы schema_migrations нет: все миграции не применены
+	var exists bool
+	if err := app.db.QueryRowContext(ctx, app.dialect.hasSchemaMigrations).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("ошибка при проверке таблицы schema_migrations: %v", err)
+	}
+	current := make(map[int]time.Time)
+	if exists {
+		if current, err = appliedMigrations(ctx, app.db); err != nil {
+			return nil, err
+		}
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		s := MigrationStatus{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := current[m.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = &appliedAt
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// withMigrationLock берёт отдельное соединение, захватывает на нём блокировку миграций
+// (advisory lock в PostgreSQL), создаёт таблицу schema_migrations и передаёт в fn
+// список миграций и уже применённые версии.
+func (app *App) withMigrationLock(ctx context.Context, fn func(conn *sql.Conn, migrations []Migration, current map[int]time.Time) error) error {
+	migrations, err := loadMigrations(app.dialect.migrations)
+	if err != nil {
+		return err
+	}
+
+	conn, err := app.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка получения соединения: %v", err)
+	}
+	defer conn.Close()
+
+	unlock, err := app.dialect.lockMigrations(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("ошибка захвата блокировки миграций: %v", err)
+	}
+	defer unlock()
+
+	if _, err := conn.ExecContext(ctx, app.dialect.schemaMigrations); err != nil {
+		return fmt.Errorf("ошибка при создании таблицы schema_migrations: %v", err)
+	}
+
+	current, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, migrations, current)
+}
+
+// appliedMigrations возвращает время применения каждой применённой версии.
+func appliedMigrations(ctx context.Context, q querier) (map[int]time.Time, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении применённых миграций: %v", err)
+	}
+	defer rows.Close()
+
+	current := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании данных из таблицы schema_migrations: %v", err)
+		}
+		current[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка во время обработки строк: %v", err)
+	}
+	return current, nil
+}
+
+// runMigration выполняет SQL миграции, шаг data (если он есть) и запись
+// в schema_migrations в одной транзакции.
+func runMigration(ctx context.Context, conn *sql.Conn, body string, data func(ctx context.Context, q querier) error, bookkeeping string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return err
+	}
+	if data != nil {
+		if err := data(ctx, tx); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
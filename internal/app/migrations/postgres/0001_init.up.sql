@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS shops (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	image TEXT NOT NULL,
+	price INTEGER NOT NULL,
+	description TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS categories (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS shop_categories (
+	shop_id INT NOT NULL,
+	category_id INT NOT NULL,
+	PRIMARY KEY (shop_id, category_id),
+	FOREIGN KEY (shop_id) REFERENCES shops(id) ON DELETE CASCADE,
+	FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+CREATE UNIQUE INDEX IF NOT EXISTS categories_name_key ON categories (name);
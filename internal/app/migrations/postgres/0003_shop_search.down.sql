@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS shops_search_idx;
+
+ALTER TABLE shops DROP COLUMN IF EXISTS search;
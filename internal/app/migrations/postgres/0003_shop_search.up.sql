@@ -0,0 +1,7 @@
+ALTER TABLE shops ADD COLUMN IF NOT EXISTS search tsvector
+	GENERATED ALWAYS AS (
+		setweight(to_tsvector('russian', coalesce(name, '')), 'A') ||
+		setweight(to_tsvector('russian', coalesce(description, '')), 'B')
+	) STORED;
+
+CREATE INDEX IF NOT EXISTS shops_search_idx ON shops USING GIN (search);
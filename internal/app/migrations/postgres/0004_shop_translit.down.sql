@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS shops_search_idx;
+ALTER TABLE shops DROP COLUMN IF EXISTS search;
+
+ALTER TABLE shops DROP COLUMN IF EXISTS name_translit;
+ALTER TABLE shops DROP COLUMN IF EXISTS description_translit;
+
+ALTER TABLE shops ADD COLUMN search tsvector
+	GENERATED ALWAYS AS (
+		setweight(to_tsvector('russian', coalesce(name, '')), 'A') ||
+		setweight(to_tsvector('russian', coalesce(description, '')), 'B')
+	) STORED;
+
+CREATE INDEX IF NOT EXISTS shops_search_idx ON shops USING GIN (search);
@@ -0,0 +1,16 @@
+-- Латинские формы названия и описания заполняет приложение: при записи магазина
+-- и шагом миграции для уже существующих магазинов.
+ALTER TABLE shops ADD COLUMN IF NOT EXISTS name_translit TEXT NOT NULL DEFAULT '';
+ALTER TABLE shops ADD COLUMN IF NOT EXISTS description_translit TEXT NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS shops_search_idx;
+ALTER TABLE shops DROP COLUMN IF EXISTS search;
+ALTER TABLE shops ADD COLUMN search tsvector
+	GENERATED ALWAYS AS (
+		setweight(to_tsvector('russian', coalesce(name, '')), 'A') ||
+		setweight(to_tsvector('russian', coalesce(description, '')), 'B') ||
+		setweight(to_tsvector('simple', name_translit), 'C') ||
+		setweight(to_tsvector('simple', description_translit), 'D')
+	) STORED;
+
+CREATE INDEX IF NOT EXISTS shops_search_idx ON shops USING GIN (search);
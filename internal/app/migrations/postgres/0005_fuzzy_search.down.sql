@@ -0,0 +1,5 @@
+-- Расширение pg_trgm не удаляется: им могут пользоваться и другие схемы.
+DROP INDEX IF EXISTS categories_name_prefix_idx;
+DROP INDEX IF EXISTS shops_name_prefix_idx;
+DROP INDEX IF EXISTS categories_name_trgm_idx;
+DROP INDEX IF EXISTS shops_name_trgm_idx;
@@ -0,0 +1,9 @@
+-- pg_trgm находит названия с опечатками и ускоряет LIKE по началам слов.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS shops_name_trgm_idx ON shops USING GIN (lower(name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS categories_name_trgm_idx ON categories USING GIN (lower(name) gin_trgm_ops);
+
+-- Для префиксов короче трёх букв триграммы не помогают, их обслуживает B-дерево
+CREATE INDEX IF NOT EXISTS shops_name_prefix_idx ON shops (lower(name) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS categories_name_prefix_idx ON categories (lower(name) text_pattern_ops);
@@ -0,0 +1,5 @@
+-- Родительская категория. Категорию с подкатегориями нельзя удалить, пока
+-- подкатегории не перенесены или не удалены; циклы проверяет приложение.
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES categories(id);
+
+CREATE INDEX IF NOT EXISTS categories_parent_id_idx ON categories (parent_id);
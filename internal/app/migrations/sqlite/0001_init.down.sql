@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS shop_categories;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS shops;
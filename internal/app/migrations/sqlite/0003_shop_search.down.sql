@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS shops_fts_update;
+DROP TRIGGER IF EXISTS shops_fts_delete;
+DROP TRIGGER IF EXISTS shops_fts_insert;
+
+DROP TABLE IF EXISTS shops_fts;
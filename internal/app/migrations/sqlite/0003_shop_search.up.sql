@@ -0,0 +1,24 @@
+-- В SQLite нет морфологии русского языка, поэтому поиск идёт по началам слов
+-- через FTS5. Индекс хранит только ссылки на строки shops и обновляется триггерами.
+CREATE VIRTUAL TABLE IF NOT EXISTS shops_fts USING fts5(
+	name,
+	description,
+	content = 'shops',
+	content_rowid = 'id',
+	tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO shops_fts (shops_fts) VALUES ('rebuild');
+
+CREATE TRIGGER IF NOT EXISTS shops_fts_insert AFTER INSERT ON shops BEGIN
+	INSERT INTO shops_fts (rowid, name, description) VALUES (new.id, new.name, new.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS shops_fts_delete AFTER DELETE ON shops BEGIN
+	INSERT INTO shops_fts (shops_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS shops_fts_update AFTER UPDATE ON shops BEGIN
+	INSERT INTO shops_fts (shops_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+	INSERT INTO shops_fts (rowid, name, description) VALUES (new.id, new.name, new.description);
+END;
@@ -0,0 +1,30 @@
+DROP TRIGGER IF EXISTS shops_fts_update;
+DROP TRIGGER IF EXISTS shops_fts_delete;
+DROP TRIGGER IF EXISTS shops_fts_insert;
+DROP TABLE IF EXISTS shops_fts;
+
+ALTER TABLE shops DROP COLUMN name_translit;
+ALTER TABLE shops DROP COLUMN description_translit;
+
+CREATE VIRTUAL TABLE shops_fts USING fts5(
+	name,
+	description,
+	content = 'shops',
+	content_rowid = 'id',
+	tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO shops_fts (shops_fts) VALUES ('rebuild');
+
+CREATE TRIGGER shops_fts_insert AFTER INSERT ON shops BEGIN
+	INSERT INTO shops_fts (rowid, name, description) VALUES (new.id, new.name, new.description);
+END;
+
+CREATE TRIGGER shops_fts_delete AFTER DELETE ON shops BEGIN
+	INSERT INTO shops_fts (shops_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+END;
+
+CREATE TRIGGER shops_fts_update AFTER UPDATE ON shops BEGIN
+	INSERT INTO shops_fts (shops_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+	INSERT INTO shops_fts (rowid, name, description) VALUES (new.id, new.name, new.description);
+END;
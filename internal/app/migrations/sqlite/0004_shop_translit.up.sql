@@ -0,0 +1,39 @@
+-- Латинские формы названия и описания заполняет приложение: при записи магазина
+-- и шагом миграции для уже существующих магазинов. Триггеры индекса FTS5
+-- пересоздаются, чтобы индекс включал и эти столбцы.
+ALTER TABLE shops ADD COLUMN name_translit TEXT NOT NULL DEFAULT '';
+ALTER TABLE shops ADD COLUMN description_translit TEXT NOT NULL DEFAULT '';
+
+DROP TRIGGER IF EXISTS shops_fts_update;
+DROP TRIGGER IF EXISTS shops_fts_delete;
+DROP TRIGGER IF EXISTS shops_fts_insert;
+DROP TABLE IF EXISTS shops_fts;
+
+CREATE VIRTUAL TABLE shops_fts USING fts5(
+	name,
+	description,
+	name_translit,
+	description_translit,
+	content = 'shops',
+	content_rowid = 'id',
+	tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO shops_fts (shops_fts) VALUES ('rebuild');
+
+CREATE TRIGGER shops_fts_insert AFTER INSERT ON shops BEGIN
+	INSERT INTO shops_fts (rowid, name, description, name_translit, description_translit)
+	VALUES (new.id, new.name, new.description, new.name_translit, new.description_translit);
+END;
+
+CREATE TRIGGER shops_fts_delete AFTER DELETE ON shops BEGIN
+	INSERT INTO shops_fts (shops_fts, rowid, name, description, name_translit, description_translit)
+	VALUES ('delete', old.id, old.name, old.description, old.name_translit, old.description_translit);
+END;
+
+CREATE TRIGGER shops_fts_update AFTER UPDATE ON shops BEGIN
+	INSERT INTO shops_fts (shops_fts, rowid, name, description, name_translit, description_translit)
+	VALUES ('delete', old.id, old.name, old.description, old.name_translit, old.description_translit);
+	INSERT INTO shops_fts (rowid, name, description, name_translit, description_translit)
+	VALUES (new.id, new.name, new.description, new.name_translit, new.description_translit);
+END;
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS categories_generation_delete;
+DROP TRIGGER IF EXISTS categories_generation_update;
+DROP TRIGGER IF EXISTS categories_generation_insert;
+DROP TRIGGER IF EXISTS shops_generation_delete;
+DROP TRIGGER IF EXISTS shops_generation_update;
+DROP TRIGGER IF EXISTS shops_generation_insert;
+
+DROP TABLE IF EXISTS search_generation;
@@ -0,0 +1,33 @@
+-- В SQLite нет pg_trgm, поэтому опечатки ищет индекс в памяти приложения.
+-- Триггеры увеличивают поколение данных при каждом изменении магазинов и
+-- категорий, и по нему приложение понимает, что индекс пора перестроить.
+CREATE TABLE IF NOT EXISTS search_generation (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	value INTEGER NOT NULL
+);
+
+INSERT OR IGNORE INTO search_generation (id, value) VALUES (1, 0);
+
+CREATE TRIGGER IF NOT EXISTS shops_generation_insert AFTER INSERT ON shops BEGIN
+	UPDATE search_generation SET value = value + 1;
+END;
+
+CREATE TRIGGER IF NOT EXISTS shops_generation_update AFTER UPDATE OF name, description ON shops BEGIN
+	UPDATE search_generation SET value = value + 1;
+END;
+
+CREATE TRIGGER IF NOT EXISTS shops_generation_delete AFTER DELETE ON shops BEGIN
+	UPDATE search_generation SET value = value + 1;
+END;
+
+CREATE TRIGGER IF NOT EXISTS categories_generation_insert AFTER INSERT ON categories BEGIN
+	UPDATE search_generation SET value = value + 1;
+END;
+
+CREATE TRIGGER IF NOT EXISTS categories_generation_update AFTER UPDATE OF name ON categories BEGIN
+	UPDATE search_generation SET value = value + 1;
+END;
+
+CREATE TRIGGER IF NOT EXISTS categories_generation_delete AFTER DELETE ON categories BEGIN
+	UPDATE search_generation SET value = value + 1;
+END;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS categories_parent_id_idx;
+
+ALTER TABLE categories DROP COLUMN parent_id;
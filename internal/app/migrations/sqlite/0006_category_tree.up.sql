@@ -0,0 +1,7 @@
+-- Родительская категория. Внешний ключ не объявлен: SQLite не умеет удалять
+-- столбец, на который ссылается ограничение, и миграцию нельзя было бы откатить.
+-- Существование родителя, отсутствие циклов и подкатегорий при удалении
+-- проверяет приложение.
+ALTER TABLE categories ADD COLUMN parent_id INTEGER;
+
+CREATE INDEX IF NOT EXISTS categories_parent_id_idx ON categories (parent_id);
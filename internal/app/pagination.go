@@ -0,0 +1,173 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// DefaultPageLimit и MaxPageLimit — размер страницы по умолчанию и наибольший.
+const (
+	DefaultPageLimit = 10
+	MaxPageLimit     = 100
+)
+
+// maxPageOffset — наибольшее смещение страницы; оно же защищает от переполнения
+// при вычислении смещения из номера страницы.
+const maxPageOffset = math.MaxInt32
+
+// pageLimit приводит лимит к диапазону от 1 до MaxPageLimit; 0 и отрицательные
+// значения заменяются на DefaultPageLimit.
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageLimit
+	}
+	return min(limit, MaxPageLimit)
+}
+
+// PageOffset возвращает смещение страницы page (нумерация с 1) при размере
+// страницы limit. Слишком большой номер страницы — ошибка проверки поля page.
+func PageOffset(page, limit int) (int, error) {
+	limit = pageLimit(limit)
+	if page < 1 || page-1 > maxPageOffset/limit {
+		return 0, NewValidationError(pageOutOfRange())
+	}
+	return (page - 1) * limit, nil
+}
+
+// checkOffset проверяет смещение, переданное в метод хранилища напрямую.
+func checkOffset(offset int) error {
+	if offset < 0 || offset > maxPageOffset {
+		return NewValidationError(pageOutOfRange())
+	}
+	return nil
+}
+
+func pageOutOfRange() FieldError {
+	return FieldError{
+		Field:   "page",
+		Code:    "out_of_range",
+		Message: fmt.Sprintf("смещение страницы должно быть от 0 до %d", maxPageOffset),
+	}
+}
+
+// ErrInvalidCursor возвращается, если курсор не был выдан сервером или повреждён.
+var ErrInvalidCursor = &Error{Kind: KindValidation, Code: "invalid_cursor", Message: "некорректный курсор"}
+
+// ShopListParams — параметры постраничной выборки магазинов. Страницы строятся
+// по магазинам, а не по строкам соединения с категориями.
+type ShopListParams struct {
+	Limit  int
+	Offset int
+	// Cursor — значение NextCursor предыдущей страницы. Если курсор задан,
+	// Offset не учитывается и выборка продолжается сразу после последнего магазина.
+	Cursor string
+	// MinPrice и MaxPrice ограничивают цену включительно; nil — без ограничения.
+	MinPrice *int
+	MaxPrice *int
+	// Categories отбирает магазины по привязке к категориям
+	Categories CategoryFilter
+	// Sort — порядок выдачи. Пустой порядок — по id, а при поиске — по релевантности.
+	Sort []SortField
+}
+
+// Page — одна страница результатов вместе с общим количеством записей.
+type Page[T any] struct {
+	Items []T `json:"items"`
+	Total int `json:"total"`
+	// NextCursor пуст, если следующей страницы нет.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// shopCursor — содержимое непрозрачного курсора: порядок выдачи и значения
+// его полей у последнего магазина страницы.
+type shopCursor struct {
+	Sort   string            `json:"sort"`
+	Values []json.RawMessage `json:"values"`
+}
+
+// nextShopCursor строит курсор, продолжающий выборку после last.
+func nextShopCursor(last ShopWithCategories, order []SortField) string {
+	c := shopCursor{Sort: formatSort(order), Values: make([]json.RawMessage, len(order))}
+	for i, field := range order {
+		c.Values[i], _ = json.Marshal(sortValue(last, field.Name))
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor разбирает курсор и проверяет, что он выдан для того же порядка:
+// курсор списка по цене нельзя продолжить в списке по имени или в поиске.
+func decodeCursor(s string, order []SortField) ([]interface{}, error) {
+	var c shopCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != formatSort(order) || len(c.Values) != len(order) {
+		return nil, ErrInvalidCursor
+	}
+
+	after := make([]interface{}, len(order))
+	for i, field := range order {
+		if after[i], err = decodeSortValue(field.Name, c.Values[i]); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return after, nil
+}
+
+// pageBounds — границы страницы: порядок выдачи, значения полей порядка
+// у магазина, после которого начинается страница (nil — с начала), смещение и лимит.
+type pageBounds struct {
+	order  []SortField
+	after  []interface{}
+	offset int
+	limit  int
+}
+
+// validate проверяет фильтры выборки.
+func (p ShopListParams) validate() []FieldError {
+	var errs []FieldError
+	if p.Offset < 0 || p.Offset > maxPageOffset {
+		errs = append(errs, pageOutOfRange())
+	}
+	if p.MinPrice != nil && p.MaxPrice != nil && *p.MinPrice > *p.MaxPrice {
+		errs = append(errs, FieldError{
+			Field:   "min_price",
+			Code:    "invalid_range",
+			Message: "min_price не может быть больше max_price",
+		})
+	}
+	if fe := p.Categories.validate(); fe != nil {
+		errs = append(errs, *fe)
+	}
+	return errs
+}
+
+// bounds проверяет параметры и возвращает границы страницы; search — выборка
+// является результатом поиска.
+func (p ShopListParams) bounds(search bool) (pageBounds, error) {
+	if errs := p.validate(); len(errs) > 0 {
+		return pageBounds{}, NewValidationError(errs...)
+	}
+
+	order, err := shopOrder(p.Sort, search)
+	if err != nil {
+		return pageBounds{}, err
+	}
+	b := pageBounds{order: order, offset: p.Offset, limit: pageLimit(p.Limit)}
+	if p.Cursor != "" {
+		if b.after, err = decodeCursor(p.Cursor, order); err != nil {
+			return pageBounds{}, err
+		}
+		b.offset = 0
+	}
+	return b, nil
+}
+
+// inPriceRange проверяет цену магазина по MinPrice и MaxPrice.
+func (p ShopListParams) inPriceRange(price int) bool {
+	return (p.MinPrice == nil || price >= *p.MinPrice) && (p.MaxPrice == nil || price <= *p.MaxPrice)
+}
@@ -0,0 +1,444 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ShopSearchParams — параметры полнотекстового поиска по названию и описанию магазина.
+type ShopSearchParams struct {
+	Query string
+	// Отбор по категориям и цене задаётся так же, как для списка магазинов
+	ShopListParams
+}
+
+// ShopHighlight — фрагменты названия и описания, в которых найденные слова
+// обёрнуты в <mark>…</mark>. Остальной текст экранирован как HTML, поэтому
+// фрагменты можно вставлять в страницу как есть.
+type ShopHighlight struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Границы найденных слов, которые СУБД ставит вместо <mark> и </mark>. Это символы
+// из области частного использования Unicode: после экранирования текста они
+// заменяются тегами, и разметка из названия или описания не попадает в ответ.
+// Такие символы в самом тексте тоже станут тегами <mark>, но не другой разметкой.
+const (
+	highlightStart = "\ue000"
+	highlightStop  = "\ue001"
+)
+
+var highlightTags = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+// markHighlight экранирует фрагмент с границами найденных слов и заменяет их на <mark>.
+func markHighlight(fragment string) string {
+	return highlightTags.Replace(html.EscapeString(fragment))
+}
+
+// shopSearch — фрагменты SQL полнотекстового поиска для одной СУБД.
+type shopSearch struct {
+	// from присоединяет к shops s источник совпадений
+	from string
+	// filter отбирает магазины, подходящие под запрос
+	filter string
+	// rank — релевантность: чем больше, тем выше магазин в выдаче
+	rank string
+	// nameHeadline и descriptionHeadline — фрагменты с подсветкой
+	nameHeadline        string
+	descriptionHeadline string
+}
+
+// postgresSearch ищет по столбцу search: исходный запрос разбирается словарём
+// russian ($first), а латинские формы слов ($first+1) — словарём simple. Названия
+// с опечатками находит pg_trgm по тому же запросу в нижнем регистре ($first+2);
+// такие совпадения весят меньше совпадений слов.
+func postgresSearch(first int) shopSearch {
+	const headline = "StartSel=" + highlightStart + ", StopSel=" + highlightStop
+	return shopSearch{
+		from: fmt.Sprintf(`CROSS JOIN (SELECT websearch_to_tsquery('russian', $%d) || to_tsquery('simple', $%d) AS query) AS q`,
+			first, first+1),
+		filter:              fmt.Sprintf(`(s.search @@ q.query OR $%d <%% lower(s.name))`, first+2),
+		rank:                fmt.Sprintf(`(ts_rank(s.search, q.query) + 0.1 * word_similarity($%d, lower(s.name)))::float8`, first+2),
+		nameHeadline:        `ts_headline('russian', s.name, q.query, 'HighlightAll=true, ` + headline + `')`,
+		descriptionHeadline: `ts_headline('russian', s.description, q.query, 'MaxFragments=2, MinWords=5, MaxWords=20, ` + headline + `')`,
+	}
+}
+
+// postgresSearchArgs возвращает исходный запрос, запрос to_tsquery по латинским
+// формам и запрос для pg_trgm. Слова без латинских форм в to_tsquery не попадают:
+// пустая группа «()» — синтаксическая ошибка, а пустая строка даёт пустой tsquery,
+// который не меняет результат websearch_to_tsquery.
+func postgresSearchArgs(query string, terms []searchTerm) []interface{} {
+	var and []string
+	for _, term := range terms {
+		var or []string
+		for _, alternative := range term[1:] {
+			var words []string
+			for _, word := range alternative {
+				if word != "" {
+					words = append(words, "'"+strings.ReplaceAll(word, "'", "''")+"':*")
+				}
+			}
+			if len(words) > 0 {
+				or = append(or, "("+strings.Join(words, " & ")+")")
+			}
+		}
+		if len(or) > 0 {
+			and = append(and, "("+strings.Join(or, " | ")+")")
+		}
+	}
+	query = strings.TrimSpace(query)
+	return []interface{}{query, strings.Join(and, " & "), strings.ToLower(query)}
+}
+
+func sqliteSearch(first int) shopSearch {
+	return shopSearch{
+		from:   `JOIN shops_fts ON shops_fts.rowid = s.id`,
+		filter: fmt.Sprintf(`shops_fts MATCH $%d`, first),
+		// bm25 тем меньше, чем лучше совпадение; совпадения в названии весят больше,
+		// совпадения латинских форм — меньше, чем совпадения исходного текста
+		rank:                `-bm25(shops_fts, 10.0, 1.0, 5.0, 0.5)`,
+		nameHeadline:        "highlight(shops_fts, 0, '" + highlightStart + "', '" + highlightStop + "')",
+		descriptionHeadline: "snippet(shops_fts, 1, '" + highlightStart + "', '" + highlightStop + "', '…', 16)",
+	}
+}
+
+// sqliteSearchArgs строит запрос FTS5, в котором все слова ищутся по началу.
+// Слова берутся в кавычки, поэтому операторы FTS5 из запроса пользователя не работают.
+func sqliteSearchArgs(query string, terms []searchTerm) []interface{} {
+	and := make([]string, len(terms))
+	for i, term := range terms {
+		or := make([]string, len(term))
+		for j, alternative := range term {
+			words := make([]string, len(alternative))
+			for k, word := range alternative {
+				words[k] = fmt.Sprintf(`"%s"*`, word)
+			}
+			or[j] = "(" + strings.Join(words, " AND ") + ")"
+		}
+		and[i] = "(" + strings.Join(or, " OR ") + ")"
+	}
+	return []interface{}{strings.Join(and, " AND ")}
+}
+
+// searchTerm — одно слово запроса в нескольких вариантах. Первый вариант —
+// слово как есть, следующие — его латинская форма и латинская форма слова,
+// набранного в другой раскладке. Вариант — список начал слов, которые должны
+// найтись все: в другой раскладке «[kt,» становится одним словом «хлеб».
+type searchTerm [][]string
+
+// searchTerms разбивает запрос на слова и строит для каждого варианты поиска.
+func searchTerms(query string) []searchTerm {
+	var terms []searchTerm
+	for _, token := range strings.Fields(normalizeSearchText(query)) {
+		var term searchTerm
+		seen := make(map[string]bool)
+		// Пустые начала слов отбрасываются: у «ъ» и «ь» нет латинской формы,
+		// а пустое начало совпало бы с любым словом
+		add := func(words []string) {
+			var stems []string
+			for _, word := range words {
+				if word != "" {
+					stems = append(stems, word)
+				}
+			}
+			key := strings.Join(stems, " ")
+			if len(stems) == 0 || seen[key] {
+				return
+			}
+			seen[key] = true
+			term = append(term, stems)
+		}
+
+		words := strings.FieldsFunc(token, isWordSeparator)
+		if len(words) == 0 {
+			continue
+		}
+		direct := make([]string, len(words))
+		latin := make([]string, len(words))
+		for i, word := range words {
+			direct[i] = stemWord(word)
+			latin[i] = stemWord(latinForm(word))
+		}
+		// Исходное слово всегда первое, даже если совпадает с латинской формой
+		term = append(term, direct)
+		add(latin)
+
+		switched := strings.FieldsFunc(switchLayout(token), isWordSeparator)
+		for i, word := range switched {
+			switched[i] = stemWord(latinForm(word))
+		}
+		add(switched)
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// stemWord отрезает у длинных слов окончания. Это грубая замена морфологии
+// для SQLite и хранилища в памяти: «магазины» и «магазинов» превращаются
+// в начало слова «магазин».
+func stemWord(word string) string {
+	n := utf8.RuneCountInString(word)
+	switch {
+	case n > 5:
+		return string([]rune(word)[:n-2])
+	case n > 3:
+		return string([]rune(word)[:n-1])
+	}
+	return word
+}
+
+// normalizeSearchText приводит текст к нижнему регистру и заменяет «ё» на «е».
+func normalizeSearchText(text string) string {
+	return strings.ReplaceAll(strings.ToLower(text), "ё", "е")
+}
+
+func (app *App) SearchShops(ctx context.Context, params ShopSearchParams) (Page[ShopWithCategories], error) {
+	sq, ok, err := app.searchQuery(ctx, params.Query)
+	if err != nil || !ok {
+		return Page[ShopWithCategories]{Items: []ShopWithCategories{}}, err
+	}
+	return app.queryShopPage(ctx, app.db, sq, params.ShopListParams)
+}
+
+// searchQuery строит выборку магазинов, подходящих под запрос query.
+// ok = false, если в запросе нет ни одного слова.
+func (app *App) searchQuery(ctx context.Context, query string) (sq shopQuery, ok bool, err error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return shopQuery{}, false, nil
+	}
+
+	if !app.dialect.trigram {
+		index, err := app.fuzzyIndex(ctx)
+		if err != nil {
+			return shopQuery{}, false, err
+		}
+		terms = index.expand(terms)
+	}
+
+	args := app.dialect.searchArgs(query, terms)
+	search := app.dialect.search(1)
+	return shopQuery{from: search.from, filter: search.filter, args: args, search: &search}, true, nil
+}
+
+// Suggest возвращает до limit названий магазинов и категорий для поля поиска,
+// слова которых начинаются со слов prefix, с учётом опечаток.
+func (app *App) Suggest(ctx context.Context, prefix string, limit int) ([]Suggestion, error) {
+	if !app.dialect.trigram {
+		index, err := app.fuzzyIndex(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return index.suggest(prefix, limit), nil
+	}
+
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" {
+		return []Suggestion{}, nil
+	}
+	like := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+
+	// Сначала названия, в которых есть слово, начинающееся с prefix, затем
+	// начинающиеся с prefix целиком, затем самые похожие по pg_trgm
+	query := `
+		SELECT type, id, name FROM (
+			SELECT 'shop' AS type, id, name FROM shops
+			WHERE lower(name) LIKE $2 OR lower(name) LIKE $3 OR $1 <% lower(name)
+			UNION ALL
+			SELECT 'category' AS type, id, name FROM categories
+			WHERE lower(name) LIKE $2 OR lower(name) LIKE $3 OR $1 <% lower(name)
+		) s
+		ORDER BY (lower(name) LIKE $2 OR lower(name) LIKE $3) DESC,
+			lower(name) LIKE $2 DESC,
+			word_similarity($1, lower(name)) DESC,
+			length(name), name, type, id
+		LIMIT $4`
+	rows, err := app.db.QueryContext(ctx, query, prefix, like+"%", "% "+like+"%", limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выполнении запроса: %v", err)
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var s Suggestion
+		if err := rows.Scan(&s.Type, &s.ID, &s.Name); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании данных: %v", err)
+		}
+		suggestions = append(suggestions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка во время обработки строк: %v", err)
+	}
+	return suggestions, nil
+}
+
+// fuzzyIndex возвращает индекс опечаток для СУБД без pg_trgm. Поколение данных
+// ведут триггеры таблицы search_generation, поэтому индекс перестраивается после
+// любого изменения магазинов и категорий, в том числе сделанного другим процессом.
+// Перестройка идёт в фоне и не должна прерываться вместе с запросом, который её начал.
+func (app *App) fuzzyIndex(ctx context.Context) (*fuzzyIndex, error) {
+	var generation int64
+	if err := app.db.QueryRowContext(ctx, `SELECT value FROM search_generation`).Scan(&generation); err != nil {
+		return nil, fmt.Errorf("ошибка при получении поколения данных: %v", err)
+	}
+	return app.fuzzy.get(generation, func() func() (*fuzzyIndex, error) {
+		return func() (*fuzzyIndex, error) {
+			index, err := app.loadFuzzyIndex(context.WithoutCancel(ctx))
+			if err != nil {
+				app.logger.WarnContext(ctx, "не удалось построить индекс опечаток", "error", err)
+			}
+			return index, err
+		}
+	})
+}
+
+func (app *App) loadFuzzyIndex(ctx context.Context) (*fuzzyIndex, error) {
+	rows, err := app.db.QueryContext(ctx, `SELECT id, name, description FROM shops ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении магазинов: %v", err)
+	}
+	defer rows.Close()
+
+	var shops []Shop
+	for rows.Next() {
+		var shop Shop
+		if err := rows.Scan(&shop.ID, &shop.Name, &shop.Description); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании магазина: %v", err)
+		}
+		shops = append(shops, shop)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка во время обработки строк: %v", err)
+	}
+	rows.Close()
+
+	rows, err = app.db.QueryContext(ctx, `SELECT id, name FROM categories ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении категорий: %v", err)
+	}
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		var category Category
+		if err := rows.Scan(&category.ID, &category.Name); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании категории: %v", err)
+		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка во время обработки строк: %v", err)
+	}
+	return newFuzzyIndex(shops, categories), nil
+}
+
+// searchColumn — слова одного поля магазина и вес совпадения в нём, как у bm25 в SQLite.
+type searchColumn struct {
+	words  []string
+	weight float64
+}
+
+// matchShop ищет слова запроса в магазине так же, как SQLite: каждое слово запроса
+// хотя бы в одном варианте должно быть началом какого-нибудь слова названия,
+// описания или их латинских форм. Совпадение в названии весит в десять раз
+// больше, чем в описании, а совпадение латинской формы — вдвое меньше исходного.
+func matchShop(shop Shop, terms []searchTerm) (float64, ShopHighlight, bool) {
+	columns := []searchColumn{
+		{strings.FieldsFunc(normalizeSearchText(shop.Name), isWordSeparator), 10},
+		{strings.FieldsFunc(normalizeSearchText(shop.Description), isWordSeparator), 1},
+		{strings.Fields(searchForm(shop.Name)), 5},
+		{strings.Fields(searchForm(shop.Description)), 0.5},
+	}
+
+	var rank float64
+	var stems []string
+	for _, term := range terms {
+		best, found := 0.0, false
+		for _, alternative := range term {
+			stems = append(stems, alternative...)
+			if weight, ok := matchAlternative(columns, alternative); ok && (!found || weight > best) {
+				best, found = weight, true
+			}
+		}
+		if !found {
+			return 0, ShopHighlight{}, false
+		}
+		rank += best
+	}
+	return rank, ShopHighlight{
+		Name:        highlightWords(shop.Name, stems),
+		Description: highlightWords(shop.Description, stems),
+	}, true
+}
+
+// matchAlternative проверяет, что каждое слово варианта найдено хотя бы
+// в одном поле, и возвращает сумму весов полей с совпадениями.
+func matchAlternative(columns []searchColumn, alternative []string) (float64, bool) {
+	var weight float64
+	for _, stem := range alternative {
+		found := false
+		for _, column := range columns {
+			if containsWordPrefix(column.words, stem) {
+				weight += column.weight
+				found = true
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return weight, true
+}
+
+func containsWordPrefix(words []string, stem string) bool {
+	for _, word := range words {
+		if strings.HasPrefix(word, stem) {
+			return true
+		}
+	}
+	return false
+}
+
+// highlightWords оборачивает в <mark> слова text, начинающиеся с одного из stems,
+// и экранирует остальной текст как HTML.
+func highlightWords(text string, stems []string) string {
+	var b strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if isWordSeparator(runes[i]) {
+			b.WriteString(html.EscapeString(string(runes[i])))
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && !isWordSeparator(runes[j]) {
+			j++
+		}
+		word := string(runes[i:j])
+		marked := false
+		for _, stem := range stems {
+			if strings.HasPrefix(normalizeSearchText(word), stem) {
+				marked = true
+				break
+			}
+		}
+		if marked {
+			b.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+		i = j
+	}
+	return b.String()
+}
+
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStemWord(t *testing.T) {
+	// Формы одного слова должны давать начала, с которых начинается и само слово
+	tests := []struct {
+		words []string
+		base  string
+	}{
+		{[]string{"магазин", "магазины", "магазинов", "магазином"}, "магазин"},
+		{[]string{"книга", "книги", "книгу"}, "книга"},
+		{[]string{"кофе"}, "кофе"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.base, func(t *testing.T) {
+			for _, word := range tt.words {
+				if stem := stemWord(word); !strings.HasPrefix(tt.base, stem) {
+					t.Errorf("stemWord(%q) = %q не является началом %q", word, stem, tt.base)
+				}
+			}
+		})
+	}
+}
+
+func TestHighlightWords(t *testing.T) {
+	tests := []struct {
+		text  string
+		stems []string
+		want  string
+	}{
+		{"Книжный магазин Буква", []string{"магаз"}, "Книжный <mark>магазин</mark> Буква"},
+		{"Магазин, магазины!", []string{"магаз"}, "<mark>Магазин</mark>, <mark>магазины</mark>!"},
+		{"Ёлки и ели", []string{"ел"}, "<mark>Ёлки</mark> и <mark>ели</mark>"},
+		{"Пекарня", []string{"магаз"}, "Пекарня"},
+		// Разметка из текста магазина экранируется
+		{"<script>alert(1)</script> магазин", []string{"script", "магаз"},
+			"&lt;<mark>script</mark>&gt;alert(1)&lt;/<mark>script</mark>&gt; <mark>магазин</mark>"},
+		{"Чай & кофе", []string{"ко"}, "Чай &amp; <mark>кофе</mark>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := highlightWords(tt.text, tt.stems); got != tt.want {
+				t.Errorf("highlightWords = %q, ожидается %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkHighlight(t *testing.T) {
+	// Так подсвечивают найденные слова PostgreSQL и SQLite
+	fragment := highlightStart + "Чай" + highlightStop + " & <b>кофе</b>"
+	if got, want := markHighlight(fragment), "<mark>Чай</mark> &amp; &lt;b&gt;кофе&lt;/b&gt;"; got != want {
+		t.Errorf("markHighlight = %q, ожидается %q", got, want)
+	}
+}
+
+func TestMatchShopHighlight(t *testing.T) {
+	// Подсвечиваются слова, совпавшие с запросом как он есть, без окончаний
+	shop := Shop{Name: "Книжный магазин Буква", Description: "Книги, журналы и канцелярия"}
+	rank, highlight, ok := matchShop(shop, searchTerms("магазины книги"))
+	if !ok {
+		t.Fatal("магазин не найден")
+	}
+	if rank <= 0 {
+		t.Errorf("релевантность %v, ожидается положительная", rank)
+	}
+	if !strings.Contains(highlight.Name, "<mark>магазин</mark>") {
+		t.Errorf("в названии не подсвечено слово: %q", highlight.Name)
+	}
+	if !strings.Contains(highlight.Description, "<mark>Книги</mark>") {
+		t.Errorf("в описании не подсвечено слово: %q", highlight.Description)
+	}
+
+	// Совпадение в названии весит больше совпадения в описании
+	byName, _, _ := matchShop(shop, searchTerms("буква"))
+	byDescription, _, _ := matchShop(shop, searchTerms("журналы"))
+	if byName <= byDescription {
+		t.Errorf("релевантность по названию %v не больше, чем по описанию %v", byName, byDescription)
+	}
+}
+
+func TestSearchTermsWithoutLatinForm(t *testing.T) {
+	// У «ъ» и «ь» нет латинской формы: пустое начало совпало бы с любым словом
+	for _, query := range []string{"ъ", "ь", "объ-ъ", "24"} {
+		for _, term := range searchTerms(query) {
+			for _, alternative := range term {
+				for _, word := range alternative {
+					if word == "" {
+						t.Errorf("searchTerms(%q) = %q: пустое начало слова", query, searchTerms(query))
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPostgresSearchArgs(t *testing.T) {
+	tests := []struct {
+		query   string
+		tsquery string
+	}{
+		{"кофе", "(('kof':*) | ('ria':*))"},
+		{"24", "(('24':*))"},
+		{"ъ", ""},
+		{"ъ 24", "(('24':*))"},
+		{"---", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			args := postgresSearchArgs(tt.query, searchTerms(tt.query))
+			if got := args[1]; got != tt.tsquery {
+				t.Errorf("to_tsquery(%q), ожидается %q", got, tt.tsquery)
+			}
+		})
+	}
+}
@@ -1,8 +1,8 @@
 package app
 
 import (
+	"context"
 	"fmt"
-	"log"
 )
 
 type ShopCategory struct {
@@ -10,38 +10,21 @@ type ShopCategory struct {
 	CategoryID int `json:"category_id"`
 }
 
-func (app *App) CreateShopCategoryTable() {
-	query := `
-	CREATE TABLE IF NOT EXISTS shop_categories (
-		shop_id INT NOT NULL,
-		category_id INT NOT NULL,
-		PRIMARY KEY (shop_id, category_id),
-		FOREIGN KEY (shop_id) REFERENCES shops(id) ON DELETE CASCADE,
-		FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
-	);`
-
-	_, err := app.db.Exec(query)
-	if err != nil {
-		log.Fatal("Ошибка при создании таблицы shop_categories:", err)
-	}
-
-	fmt.Println("Таблица shop_categories успешно создана (если её не было)!")
-}
-
-func (app *App) InsertShopCategory(shopID, categoryID int) {
+func (app *App) InsertShopCategory(ctx context.Context, shopID, categoryID int) error {
 	query := `INSERT INTO shop_categories (shop_id, category_id) VALUES ($1, $2)`
-	_, err := app.db.Exec(query, shopID, categoryID)
+	_, err := app.db.ExecContext(ctx, query, shopID, categoryID)
 	if err != nil {
-		log.Fatal("Ошибка при вставке данных в таблицу shop_categories:", err)
+		return fmt.Errorf("ошибка при вставке данных в таблицу shop_categories: %v", err)
 	}
 
-	fmt.Println("Связь между магазином и категорией успешно добавлена!")
+	app.logger.DebugContext(ctx, "магазин привязан к категории", "shop_id", shopID, "category_id", categoryID)
+	return nil
 }
 
-func (app *App) GetShopCategories() ([]ShopCategory, error) {
+func (app *App) GetShopCategories(ctx context.Context) ([]ShopCategory, error) {
 	query := `SELECT shop_id, category_id FROM shop_categories;`
 
-	rows, err := app.db.Query(query)
+	rows, err := app.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении данных из таблицы shop_categories: %v", err)
 	}
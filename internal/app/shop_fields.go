@@ -0,0 +1,122 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ShopPatch — изменения магазина. Fields содержит новые значения полей по именам
+// столбцов таблицы shops, CategoryIDs — новый набор категорий или nil, если
+// категории не меняются.
+type ShopPatch struct {
+	Fields      map[string]interface{}
+	CategoryIDs []int
+}
+
+// shopFieldTypes — белый список изменяемых полей магазина и их типы в JSON.
+// Только эти имена попадают в текст запроса UPDATE.
+var shopFieldTypes = map[string]string{
+	"name":        "string",
+	"image":       "string",
+	"price":       "integer",
+	"description": "string",
+}
+
+// shopReadOnlyFields — поля магазина, которые нельзя изменить через API.
+var shopReadOnlyFields = map[string]bool{
+	"id": true,
+}
+
+// ValidateShopFields проверяет поля магазина по белому списку и типам и возвращает
+// ошибки по всем полям сразу, в порядке их имён.
+func ValidateShopFields(fields map[string]interface{}) []FieldError {
+	_, errs := convertShopFields(fields)
+	return errs
+}
+
+// checkShopFields проверяет поля и приводит значения к типам столбцов.
+func checkShopFields(fields map[string]interface{}) (map[string]interface{}, error) {
+	checked, errs := convertShopFields(fields)
+	if len(errs) > 0 {
+		return nil, NewValidationError(errs...)
+	}
+	return checked, nil
+}
+
+func convertShopFields(fields map[string]interface{}) (map[string]interface{}, []FieldError) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	checked := make(map[string]interface{}, len(fields))
+	var errs []FieldError
+	for _, name := range names {
+		value := fields[name]
+		fieldType, ok := shopFieldTypes[name]
+		switch {
+		case shopReadOnlyFields[name]:
+			errs = append(errs, FieldError{Field: name, Code: "read_only", Message: "поле нельзя изменить"})
+			continue
+		case !ok:
+			errs = append(errs, FieldError{Field: name, Code: "unknown_field", Message: "неизвестное поле"})
+			continue
+		case value == nil:
+			errs = append(errs, FieldError{Field: name, Code: "required", Message: "обязательное поле"})
+			continue
+		}
+
+		switch fieldType {
+		case "string":
+			// Пробелы по краям обрезаются так же, как в normalizeShop
+			if str, ok := value.(string); ok {
+				checked[name] = strings.TrimSpace(str)
+				continue
+			}
+		case "integer":
+			if i, ok := toInt(value); ok {
+				checked[name] = i
+				continue
+			}
+		}
+		errs = append(errs, FieldError{
+			Field:   name,
+			Code:    "invalid_type",
+			Message: fmt.Sprintf("ожидается значение типа %s, получено %v", fieldType, value),
+		})
+	}
+
+	return checked, errs
+}
+
+// setShopFields присваивает магазину значения, уже проверенные checkShopFields.
+func setShopFields(shop *Shop, fields map[string]interface{}) {
+	for name, value := range fields {
+		switch name {
+		case "name":
+			shop.Name = value.(string)
+		case "image":
+			shop.Image = value.(string)
+		case "price":
+			shop.Price = value.(int)
+		case "description":
+			shop.Description = value.(string)
+		}
+	}
+}
+
+// toInt принимает целые числа; JSON декодирует их в float64.
+func toInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case float64:
+		if v != float64(int(v)) {
+			return 0, false
+		}
+		return int(v), true
+	}
+	return 0, false
+}
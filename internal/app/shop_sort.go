@@ -0,0 +1,200 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SortField — поле сортировки магазинов. Desc задаёт порядок по убыванию.
+type SortField struct {
+	Name string
+	Desc bool
+}
+
+// shopSortColumns — белый список полей сортировки и их столбцы в подзапросе
+// queryShopPage. Только эти имена попадают в текст запроса ORDER BY.
+var shopSortColumns = map[string]string{
+	"id":    "s.id",
+	"name":  "s.name",
+	"price": "s.price",
+	"rank":  "s.rank",
+}
+
+// ParseShopSort разбирает параметр sort вида "price,-name,id": поля через запятую,
+// минус перед полем означает сортировку по убыванию. Ошибки возвращаются по всем
+// полям сразу.
+func ParseShopSort(s string) ([]SortField, []FieldError) {
+	var fields []SortField
+	var errs []FieldError
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		field := SortField{Name: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		switch _, ok := shopSortColumns[field.Name]; {
+		case !ok:
+			errs = append(errs, FieldError{Field: "sort", Code: "invalid_sort", Message: fmt.Sprintf("неизвестное поле сортировки %q", part)})
+		case seen[field.Name]:
+			errs = append(errs, FieldError{Field: "sort", Code: "invalid_sort", Message: fmt.Sprintf("поле сортировки %q указано повторно", field.Name)})
+		default:
+			seen[field.Name] = true
+			fields = append(fields, field)
+		}
+	}
+	return fields, errs
+}
+
+// shopOrder дополняет порядок выдачи: без sort список упорядочен по id, а поиск —
+// по релевантности. В конец всегда добавляется id, если его нет, — так порядок
+// однозначен и страницы не повторяют и не пропускают магазины.
+func shopOrder(sort []SortField, search bool) ([]SortField, error) {
+	order := make([]SortField, 0, len(sort)+1)
+	hasID := false
+	for _, field := range sort {
+		if field.Name == "rank" && !search {
+			return nil, NewValidationError(FieldError{Field: "sort", Code: "invalid_sort", Message: "сортировка по rank доступна только при поиске"})
+		}
+		hasID = hasID || field.Name == "id"
+		order = append(order, field)
+	}
+	if len(order) == 0 && search {
+		order = append(order, SortField{Name: "rank", Desc: true})
+	}
+	if !hasID {
+		order = append(order, SortField{Name: "id"})
+	}
+	return order, nil
+}
+
+// formatSort записывает порядок выдачи в том же виде, что и параметр sort.
+func formatSort(order []SortField) string {
+	parts := make([]string, len(order))
+	for i, field := range order {
+		parts[i] = field.Name
+		if field.Desc {
+			parts[i] = "-" + field.Name
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// sortValue возвращает значение поля сортировки магазина.
+func sortValue(item ShopWithCategories, field string) interface{} {
+	switch field {
+	case "name":
+		return item.Shop.Name
+	case "price":
+		return item.Shop.Price
+	case "rank":
+		return item.Rank
+	}
+	return item.Shop.ID
+}
+
+// decodeSortValue разбирает значение поля сортировки из курсора.
+func decodeSortValue(field string, data json.RawMessage) (interface{}, error) {
+	var err error
+	switch field {
+	case "name":
+		var v string
+		err = json.Unmarshal(data, &v)
+		return v, err
+	case "rank":
+		var v float64
+		err = json.Unmarshal(data, &v)
+		return v, err
+	}
+	var v int
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
+
+// compareSortValues сравнивает значения одного поля сортировки.
+func compareSortValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int:
+		return compareOrdered(a, b.(int))
+	case float64:
+		return compareOrdered(a, b.(float64))
+	case string:
+		return compareOrdered(a, b.(string))
+	}
+	return 0
+}
+
+func compareOrdered[T int | float64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareShops сравнивает магазины в порядке order: отрицательное значение
+// означает, что a идёт раньше b.
+func compareShops(a, b ShopWithCategories, order []SortField) int {
+	for _, field := range order {
+		c := compareSortValues(sortValue(a, field.Name), sortValue(b, field.Name))
+		if field.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareShopKey сравнивает магазин со значениями полей сортировки, например
+// из курсора.
+func compareShopKey(item ShopWithCategories, key []interface{}, order []SortField) int {
+	for i, field := range order {
+		c := compareSortValues(sortValue(item, field.Name), key[i])
+		if field.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// keysetCondition строит условие «строка идёт после курсора» для порядка order:
+// (a > $1) OR (a = $1 AND b < $2) OR ... Значения курсора добавляются в args.
+func keysetCondition(order []SortField, after []interface{}, args []interface{}) (string, []interface{}) {
+	positions := make([]int, len(order))
+	for i := range order {
+		args = append(args, after[i])
+		positions[i] = len(args)
+	}
+
+	or := make([]string, len(order))
+	for i, field := range order {
+		and := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			and = append(and, fmt.Sprintf("%s = $%d", shopSortColumns[order[j].Name], positions[j]))
+		}
+		op := ">"
+		if field.Desc {
+			op = "<"
+		}
+		and = append(and, fmt.Sprintf("%s %s $%d", shopSortColumns[field.Name], op, positions[i]))
+		or[i] = "(" + strings.Join(and, " AND ") + ")"
+	}
+	return "(" + strings.Join(or, " OR ") + ")", args
+}
+
+// orderBy строит ORDER BY для порядка order.
+func orderBy(order []SortField) string {
+	parts := make([]string, len(order))
+	for i, field := range order {
+		parts[i] = shopSortColumns[field.Name]
+		if field.Desc {
+			parts[i] += " DESC"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
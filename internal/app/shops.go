@@ -1,9 +1,33 @@
 package app
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrShopNotFound = &Error{Kind: KindNotFound, Code: "shop_not_found", Message: "магазин не найден"}
+
+	ErrShopCategoryNotFound = &Error{
+		Kind:    KindNotFound,
+		Code:    "shop_category_not_found",
+		Message: "магазин не привязан к категории",
+	}
+	ErrShopCategoryExists = &Error{
+		Kind:    KindConflict,
+		Code:    "shop_category_exists",
+		Message: "магазин уже привязан к категории",
+	}
+	ErrTooManyIDs = &Error{
+		Kind:    KindValidation,
+		Code:    "too_many_ids",
+		Message: fmt.Sprintf("можно запросить не больше %d магазинов за раз", MaxBatchIDs),
+	}
 )
 
 type Shop struct {
@@ -14,218 +38,613 @@ type Shop struct {
 	Description string `json:"description"`
 }
 type ShopWithCategories struct {
-	Shop        Shop     `json:"shop"`
-	CategoryIDs []string `json:"categories"`
+	Shop       Shop       `json:"shop"`
+	Categories []Category `json:"categories"`
+	// Rank и Highlight заполняются только при полнотекстовом поиске
+	Rank      float64        `json:"rank,omitempty"`
+	Highlight *ShopHighlight `json:"highlight,omitempty"`
 }
 
-func (app *App) GetShops(limit, offset int) ([]ShopWithCategories, error) {
+// MaxBatchIDs — наибольшее количество магазинов в одном запросе GetShopsByIDs.
+const MaxBatchIDs = 100
 
-	query := `
-        SELECT s.id, s.name, s.image, s.price, s.description, c.name AS category_name
-        FROM shops s
-        LEFT JOIN shop_categories sc ON s.id = sc.shop_id
-        LEFT JOIN categories c ON sc.category_id = c.id
-        LIMIT $1 OFFSET $2`
+func (app *App) GetShops(ctx context.Context, params ShopListParams) (Page[ShopWithCategories], error) {
+	return app.queryShopPage(ctx, app.db, shopQuery{}, params)
+}
+
+// GetShopsByIDs возвращает найденные магазины в порядке перечисления ids;
+// отсутствующие и повторяющиеся идентификаторы пропускаются.
+func (app *App) GetShopsByIDs(ctx context.Context, ids []int) ([]ShopWithCategories, error) {
+	ids, err := uniqueBatchIDs(ids)
+	if err != nil || len(ids) == 0 {
+		return []ShopWithCategories{}, err
+	}
 
-	rows, err := app.db.Query(query, limit, offset)
+	list, args := placeholderList(ids)
+	filter := "s.id IN (" + list + ")"
+
+	page, err := app.queryShopPage(ctx, app.db, shopQuery{filter: filter, args: args}, ShopListParams{Limit: len(ids)})
 	if err != nil {
-		fmt.Println("Ошибка запроса к базе данных:", err)
 		return nil, err
 	}
-	defer rows.Close()
-
-	var result []ShopWithCategories
+	return orderByIDs(page.Items, ids), nil
+}
 
-	// Проходим по всем строкам результата запроса
-	for rows.Next() {
-		var shop Shop
-		var categoryName sql.NullString
+func (app *App) GetShopByID(ctx context.Context, id int) (ShopWithCategories, error) {
+	page, err := app.queryShopPage(ctx, app.db, shopQuery{filter: `s.id = $1`, args: []interface{}{id}}, ShopListParams{Limit: 1})
+	if err != nil {
+		return ShopWithCategories{}, err
+	}
+	if len(page.Items) == 0 {
+		return ShopWithCategories{}, ErrShopNotFound
+	}
+	return page.Items[0], nil
+}
 
-		// Сканируем данные о магазине
-		if err := rows.Scan(&shop.ID, &shop.Name, &shop.Image, &shop.Price, &shop.Description, &categoryName); err != nil {
-			fmt.Println("Ошибка сканирования данных:", err)
-			return nil, err
-		}
+// Функция для добавления одной записи в таблицу shops
+func (app *App) InsertShop(ctx context.Context, name, image string, price int, description string) error {
+	query := `
+		INSERT INTO shops (name, image, price, description, name_translit, description_translit)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := app.db.ExecContext(ctx, query, name, image, price, description, searchForm(name), searchForm(description))
+	if err != nil {
+		return fmt.Errorf("ошибка при вставке данных: %v", err)
+	}
 
-		// Формируем структуру для магазина с категориями
-		shopWithCategories := ShopWithCategories{
-			Shop:        shop,       // Заполняем информацию о магазине
-			CategoryIDs: []string{}, // Инициализируем список категорий
-		}
+	app.logger.DebugContext(ctx, "магазин добавлен", "name", name)
+	return nil
+}
 
-		// Если категория присутствует, добавляем её в список категорий
-		if categoryName.Valid {
-			shopWithCategories.CategoryIDs = append(shopWithCategories.CategoryIDs, categoryName.String)
-		}
+func (app *App) CreateNewShop(ctx context.Context, shop Shop) (int, error) {
+	return app.CreateShop(ctx, shop, nil)
+}
 
-		// Проверяем, если магазин уже добавлен, добавляем категорию
-		found := false
-		for i, s := range result {
-			if s.Shop.ID == shopWithCategories.Shop.ID {
-				result[i].CategoryIDs = append(result[i].CategoryIDs, categoryName.String)
-				found = true
-				break
-			}
+// CreateShop добавляет магазин вместе с привязками к категориям в одной транзакции:
+// при ошибке в любой из категорий магазин не создаётся.
+func (app *App) CreateShop(ctx context.Context, shop Shop, categoryIDs []int) (int, error) {
+	shop = normalizeShop(shop)
+	var shopID int
+	err := app.withTx(ctx, func(tx querier) error {
+		if err := app.validateShop(ctx, tx, shop, nil, categoryIDs); err != nil {
+			return err
 		}
 
-		// Если магазин не найден, добавляем его в список
-		if !found {
-			result = append(result, shopWithCategories)
+		query := `
+			INSERT INTO shops (name, image, price, description, name_translit, description_translit)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+		err := tx.QueryRowContext(ctx, query, shop.Name, shop.Image, shop.Price, shop.Description,
+			searchForm(shop.Name), searchForm(shop.Description)).Scan(&shopID)
+		if err != nil {
+			return fmt.Errorf("ошибка при добавлении нового магазина: %w", app.translateError(err, 0))
 		}
+		return app.addShopCategories(ctx, tx, shopID, categoryIDs)
+	})
+	if err != nil {
+		return 0, err
 	}
-
-	return result, nil
+	app.logger.InfoContext(ctx, "магазин создан", "shop_id", shopID, "categories", len(categoryIDs))
+	return shopID, nil
 }
 
-func (app *App) CreateTable() {
-	query := `
-	CREATE TABLE IF NOT EXISTS shops (
-		id SERIAL PRIMARY KEY,
-		name TEXT NOT NULL,
-		image TEXT NOT NULL,
-		price INTEGER NOT NULL,
-		description TEXT NOT NULL
-	);`
+func (app *App) DeleteShopByID(ctx context.Context, id string) error {
+	shopID, err := parseID(id)
+	if err != nil {
+		return fmt.Errorf("ошибка при удалении магазина: %w", err)
+	}
+
+	query := `DELETE FROM shops WHERE id = $1`
 
-	_, err := app.db.Exec(query)
+	res, err := app.db.ExecContext(ctx, query, shopID)
 	if err != nil {
-		log.Fatal("Ошибка при создании таблицы:", err)
+		return fmt.Errorf("ошибка при удалении магазина: %v", err)
 	}
+	return checkAffected(res, ErrShopNotFound)
+}
 
-	fmt.Println("Таблица shops успешно создана (если её не было)!")
+func (app *App) UpdateShopByID(ctx context.Context, id string, updatedShop Shop) error {
+	shopID, err := parseID(id)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении магазина: %w", err)
+	}
+	updatedShop = normalizeShop(updatedShop)
+	if err := validateShop(updatedShop, nil, nil, nil); err != nil {
+		return err
+	}
+	return app.updateShop(ctx, app.db, shopID, updatedShop)
 }
 
-// Функция для добавления одной записи в таблицу shops
-func (app *App) InsertShop(name, image string, price int, description string) {
-	query := `INSERT INTO shops (name, image, price, description) VALUES ($1, $2, $3, $4)`
-	_, err := app.db.Exec(query, name, image, price, description)
+// ReplaceShop заменяет данные магазина и весь набор его категорий в одной транзакции.
+func (app *App) ReplaceShop(ctx context.Context, id string, shop Shop, categoryIDs []int) error {
+	shopID, err := parseID(id)
 	if err != nil {
-		log.Fatal("Ошибка при вставке данных:", err)
+		return fmt.Errorf("ошибка при обновлении магазина: %w", err)
 	}
+	shop = normalizeShop(shop)
 
-	fmt.Println("Данные успешно добавлены!")
+	return app.withTx(ctx, func(tx querier) error {
+		if err := app.validateShop(ctx, tx, shop, nil, categoryIDs); err != nil {
+			return err
+		}
+		if err := app.updateShop(ctx, tx, shopID, shop); err != nil {
+			return err
+		}
+		return app.replaceShopCategories(ctx, tx, shopID, categoryIDs)
+	})
 }
 
-func (app *App) CreateNewShop(shop Shop) (int, error) {
-	query := `INSERT INTO shops (name, image, price, description) VALUES ($1, $2, $3, $4) RETURNING id`
-	var shopID int
-	err := app.db.QueryRow(query, shop.Name, shop.Image, shop.Price, shop.Description).Scan(&shopID)
+func (app *App) UpdateShopFields(ctx context.Context, id string, fields map[string]interface{}) error {
+	shopID, err := parseID(id)
 	if err != nil {
-		return 0, fmt.Errorf("ошибка при добавлении нового магазина: %v", err)
+		return err
 	}
-	fmt.Println("Новый магазин успешно добавлен с ID:", shopID)
-	return shopID, nil
+	checked, err := checkShopFields(fields)
+	if err != nil {
+		return err
+	}
+	// Правила проверяют поля независимо, поэтому достаточно заполнить только изменяемые
+	var shop Shop
+	setShopFields(&shop, checked)
+	if err := validateShop(shop, checked, nil, nil); err != nil {
+		return err
+	}
+	return app.updateShopFields(ctx, app.db, shopID, checked)
 }
 
-func (app *App) DeleteShopByID(id string) error {
-	query := `DELETE FROM shops WHERE id = $1`
-
-	_, err := app.db.Exec(query, id)
+// PatchShop изменяет переданные поля магазина и, если categoryIDs не nil,
+// заменяет набор его категорий. Всё выполняется в одной транзакции.
+func (app *App) PatchShop(ctx context.Context, id string, fields map[string]interface{}, categoryIDs []int) error {
+	shopID, err := parseID(id)
 	if err != nil {
-		return fmt.Errorf("ошибка при удалении магазина: %v", err)
+		return err
 	}
-	return nil
+	return app.ApplyShopPatch(ctx, shopID, func(ShopWithCategories) (ShopPatch, error) {
+		return ShopPatch{Fields: fields, CategoryIDs: categoryIDs}, nil
+	})
+}
+
+// ApplyShopPatch читает магазин, передаёт его текущее состояние в patch и сохраняет
+// полученные изменения. Чтение и запись выполняются в одной транзакции, а строка
+// магазина блокируется, поэтому patch видит данные, которые и будут изменены.
+func (app *App) ApplyShopPatch(ctx context.Context, id int, patch func(current ShopWithCategories) (ShopPatch, error)) error {
+	return app.withTx(ctx, func(tx querier) error {
+		var locked int
+		err := tx.QueryRowContext(ctx, `SELECT id FROM shops WHERE id = $1`+app.dialect.forUpdate, id).Scan(&locked)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrShopNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка при блокировке магазина: %v", err)
+		}
+
+		current, err := app.queryShopPage(ctx, tx, shopQuery{filter: `s.id = $1`, args: []interface{}{id}}, ShopListParams{Limit: 1})
+		if err != nil {
+			return err
+		}
+		changes, err := patch(current.Items[0])
+		if err != nil {
+			return err
+		}
+
+		fields, err := checkShopFields(changes.Fields)
+		if err != nil {
+			return err
+		}
+		shop := current.Items[0].Shop
+		setShopFields(&shop, fields)
+		if err := app.validateShop(ctx, tx, shop, fields, changes.CategoryIDs); err != nil {
+			return err
+		}
+		if len(fields) > 0 {
+			if err := app.updateShopFields(ctx, tx, id, fields); err != nil {
+				return err
+			}
+		}
+		if changes.CategoryIDs == nil {
+			return nil
+		}
+		return app.replaceShopCategories(ctx, tx, id, changes.CategoryIDs)
+	})
 }
 
-func (app *App) UpdateShopByID(id string, updatedShop Shop) error {
+func (app *App) updateShop(ctx context.Context, q querier, shopID int, updatedShop Shop) error {
 	query := `
 		UPDATE shops 
-		SET name = $1, image = $2, price = $3, description = $4 
-		WHERE id = $5`
+		SET name = $1, image = $2, price = $3, description = $4,
+			name_translit = $5, description_translit = $6
+		WHERE id = $7`
 
-	_, err := app.db.Exec(query, updatedShop.Name, updatedShop.Image, updatedShop.Price, updatedShop.Description, id)
+	res, err := q.ExecContext(ctx, query, updatedShop.Name, updatedShop.Image, updatedShop.Price, updatedShop.Description,
+		searchForm(updatedShop.Name), searchForm(updatedShop.Description), shopID)
 	if err != nil {
-		return fmt.Errorf("ошибка при обновлении магазина: %v", err)
+		return fmt.Errorf("ошибка при обновлении магазина: %w", app.translateError(err, 0))
 	}
-	return nil
+	return checkAffected(res, ErrShopNotFound)
 }
-func (app *App) UpdateShopFields(id string, fields map[string]interface{}) error {
-	query := "UPDATE shops SET "
-	args := []interface{}{}
-	i := 1
 
-	// Динамически создаем часть запроса для каждого переданного поля
+// updateShopFields изменяет поля, уже проверенные checkShopFields. Имена столбцов
+// берутся только из белого списка, а значения передаются параметрами запроса.
+func (app *App) updateShopFields(ctx context.Context, q querier, shopID int, fields map[string]interface{}) error {
+	if len(fields) == 0 {
+		return checkShopExists(ctx, q, shopID)
+	}
+
+	values := make(map[string]interface{}, len(fields)+len(shopSearchForms))
 	for field, value := range fields {
-		query += fmt.Sprintf("%s = $%d, ", field, i)
-		args = append(args, value)
-		i++
+		if _, ok := shopFieldTypes[field]; !ok {
+			return fmt.Errorf("поле %q не входит в белый список", field)
+		}
+		values[field] = value
+	}
+	// Поисковая форма поля меняется вместе с самим полем
+	for field, form := range shopSearchForms {
+		if text, ok := fields[field].(string); ok {
+			values[form] = searchForm(text)
+		}
+	}
+
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	// Динамически создаем часть запроса для каждого переданного поля
+	set := make([]string, len(columns))
+	args := make([]interface{}, 0, len(columns)+1)
+	for i, column := range columns {
+		set[i] = fmt.Sprintf("%s = $%d", column, i+1)
+		args = append(args, values[column])
 	}
-	query = query[:len(query)-2] // Удаляем последнюю запятую и пробел
-	query += " WHERE id = $" + fmt.Sprintf("%d", i)
-	args = append(args, id)
+	query := fmt.Sprintf("UPDATE shops SET %s WHERE id = $%d", strings.Join(set, ", "), len(columns)+1)
+	args = append(args, shopID)
 
 	// Выполняем запрос
-	_, err := app.db.Exec(query, args...)
-	return err
+	res, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении магазина: %w", app.translateError(err, 0))
+	}
+	return checkAffected(res, ErrShopNotFound)
 }
-func (app *App) GetShopsByCategoryID(categoryID string, limit, offset int) ([]Shop, error) {
-	// Формируем SQL-запрос для получения магазинов по категории с LIMIT и OFFSET
-	query := `
-	SELECT s.id, s.name, s.image, s.price, s.description
-	FROM shops s
-	JOIN shop_categories sc ON s.id = sc.shop_id
-	WHERE sc.category_id = $1
-	LIMIT $2 OFFSET $3`
 
-	rows, err := app.db.Query(query, categoryID, limit, offset)
+// shopQuery описывает выборку магазинов: условие filter с параметрами args,
+// дополнительный источник from и, для полнотекстового поиска, выражения
+// релевантности и подсветки. Без search магазины упорядочены по id.
+type shopQuery struct {
+	from   string
+	filter string
+	args   []interface{}
+	search *shopSearch
+}
+
+// queryShopPage выбирает через q страницу магазинов, удовлетворяющих условию sq,
+// вместе с их категориями и общим количеством. Категории собираются в JSON-массив
+// подзапросом, поэтому каждый магазин занимает ровно одну строку страницы.
+func (app *App) queryShopPage(ctx context.Context, q querier, sq shopQuery, params ShopListParams) (Page[ShopWithCategories], error) {
+	page := Page[ShopWithCategories]{Items: []ShopWithCategories{}}
+
+	bounds, err := params.bounds(sq.search != nil)
+	if err != nil {
+		return page, err
+	}
+
+	where, args := shopFilter(sq, params)
+	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM shops s %s WHERE %s`, sq.from, where)
+	if err := q.QueryRowContext(ctx, countQuery, args...).Scan(&page.Total); err != nil {
+		return page, fmt.Errorf("ошибка при подсчёте магазинов: %v", err)
+	}
+
+	// Вне поиска релевантность и подсветка пустые
+	rank, nameHeadline, descriptionHeadline := "0", "''", "''"
+	if sq.search != nil {
+		rank, nameHeadline, descriptionHeadline = sq.search.rank, sq.search.nameHeadline, sq.search.descriptionHeadline
+	}
+
+	// Условие продолжения после курсора по всем полям порядка выдачи
+	keyset := "TRUE"
+	if bounds.after != nil {
+		keyset, args = keysetCondition(bounds.order, bounds.after, args)
+	}
+	args = append(args, bounds.limit+1, bounds.offset)
+
+	query := fmt.Sprintf(`
+	SELECT s.id, s.name, s.image, s.price, s.description, s.rank, s.name_headline, s.description_headline,
+		(SELECT %s
+		 FROM shop_categories sc
+		 JOIN categories c ON c.id = sc.category_id
+		 WHERE sc.shop_id = s.id) AS categories
+	FROM (
+		SELECT s.id, s.name, s.image, s.price, s.description,
+			%s AS rank, %s AS name_headline, %s AS description_headline
+		FROM shops s %s
+		WHERE %s
+	) s
+	WHERE %s
+	ORDER BY %s
+	LIMIT $%d OFFSET $%d`,
+		app.dialect.jsonArrayAgg(app.dialect.jsonObject+"('id', c.id, 'name', c.name, 'parent_id', c.parent_id)", "c.id"),
+		rank, nameHeadline, descriptionHeadline, sq.from, where,
+		keyset, orderBy(bounds.order), len(args)-1, len(args))
+
+	// Запрашиваем на одну запись больше, чтобы узнать, есть ли следующая страница
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при выполнении запроса: %v", err)
+		return page, fmt.Errorf("ошибка запроса к базе данных: %v", err)
 	}
 	defer rows.Close()
 
-	// Собираем данные о магазинах
-	var shops []Shop
 	for rows.Next() {
-		var shop Shop
-		if err := rows.Scan(&shop.ID, &shop.Name, &shop.Image, &shop.Price, &shop.Description); err != nil {
-			return nil, fmt.Errorf("ошибка сканирования данных: %v", err)
+		var item ShopWithCategories
+		var categories []byte
+		var highlight ShopHighlight
+		shop := &item.Shop
+		err := rows.Scan(&shop.ID, &shop.Name, &shop.Image, &shop.Price, &shop.Description,
+			&item.Rank, &highlight.Name, &highlight.Description, &categories)
+		if err != nil {
+			return page, fmt.Errorf("ошибка сканирования данных: %v", err)
 		}
-		shops = append(shops, shop)
+		if err := json.Unmarshal(categories, &item.Categories); err != nil {
+			return page, fmt.Errorf("ошибка разбора категорий магазина %d: %v", shop.ID, err)
+		}
+		if sq.search != nil {
+			highlight.Name = markHighlight(highlight.Name)
+			highlight.Description = markHighlight(highlight.Description)
+			item.Highlight = &highlight
+		}
+		page.Items = append(page.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("ошибка во время обработки строк: %v", err)
 	}
 
-	return shops, nil
+	if len(page.Items) > bounds.limit {
+		page.Items = page.Items[:bounds.limit]
+		page.NextCursor = nextShopCursor(page.Items[bounds.limit-1], bounds.order)
+	}
+	return page, nil
 }
-func (app *App) AddShopCategories(shopID int, categoryIDs []int) error {
-	query := `INSERT INTO shop_categories (shop_id, category_id) VALUES ($1, $2)`
 
-	// Открываем транзакцию
-	tx, err := app.db.Begin()
+// shopFilter объединяет условие sq с фильтрами params по цене и категориям
+// и возвращает условие WHERE для магазина s вместе с его параметрами.
+func shopFilter(sq shopQuery, params ShopListParams) (string, []interface{}) {
+	where := "TRUE"
+	if sq.filter != "" {
+		where = sq.filter
+	}
+	args := append([]interface{}{}, sq.args...)
+	if params.MinPrice != nil {
+		args = append(args, *params.MinPrice)
+		where += fmt.Sprintf(" AND s.price >= $%d", len(args))
+	}
+	if params.MaxPrice != nil {
+		args = append(args, *params.MaxPrice)
+		where += fmt.Sprintf(" AND s.price <= $%d", len(args))
+	}
+	var categories string
+	if categories, args = params.Categories.condition(args); categories != "" {
+		where += " AND " + categories
+	}
+	return where, args
+}
+
+func (app *App) AddShopCategories(ctx context.Context, shopID int, categoryIDs []int) error {
+	err := app.withTx(ctx, func(tx querier) error {
+		return app.addShopCategories(ctx, tx, shopID, categoryIDs)
+	})
+	if err != nil {
+		return err
+	}
+
+	app.logger.InfoContext(ctx, "категории добавлены магазину", "shop_id", shopID, "categories", len(categoryIDs))
+	return nil
+}
+
+func (app *App) UpdateShopCategories(ctx context.Context, shopID string, categoryIDs []int) error {
+	id, err := parseID(shopID)
 	if err != nil {
-		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+		return fmt.Errorf("не удалось удалить старые категории: %w", err)
 	}
-	defer tx.Rollback()
 
-	// Добавляем связи между магазином и категориями
+	return app.withTx(ctx, func(tx querier) error {
+		if err := checkShopExists(ctx, tx, id); err != nil {
+			return err
+		}
+		// Пустой список полей: проверяются только категории
+		if err := app.validateShop(ctx, tx, Shop{}, map[string]interface{}{}, categoryIDs); err != nil {
+			return err
+		}
+		return app.replaceShopCategories(ctx, tx, id, categoryIDs)
+	})
+}
+
+// addShopCategories привязывает магазин к категориям.
+func (app *App) addShopCategories(ctx context.Context, q querier, shopID int, categoryIDs []int) error {
+	query := `INSERT INTO shop_categories (shop_id, category_id) VALUES ($1, $2)`
+
 	for _, categoryID := range categoryIDs {
-		_, err := tx.Exec(query, shopID, categoryID)
+		_, err := q.ExecContext(ctx, query, shopID, categoryID)
 		if err != nil {
-			return fmt.Errorf("ошибка при добавлении категории %d для магазина %d: %v", categoryID, shopID, err)
+			return fmt.Errorf("ошибка при добавлении категории %d для магазина %d: %w", categoryID, shopID, app.translateError(err, categoryID))
 		}
 	}
-
-	// Подтверждаем транзакцию
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("ошибка при подтверждении транзакции: %v", err)
-	}
-
-	fmt.Println("Категории успешно добавлены для магазина с ID:", shopID)
 	return nil
 }
 
-func (app *App) UpdateShopCategories(shopID string, categoryIDs []int) error {
+// replaceShopCategories заменяет все категории магазина на categoryIDs.
+func (app *App) replaceShopCategories(ctx context.Context, q querier, shopID int, categoryIDs []int) error {
 	// Удаляем старые категории для данного магазина
-	_, err := app.db.Exec("DELETE FROM shop_categories WHERE shop_id = $1", shopID)
+	_, err := q.ExecContext(ctx, "DELETE FROM shop_categories WHERE shop_id = $1", shopID)
 	if err != nil {
 		return fmt.Errorf("не удалось удалить старые категории: %v", err)
 	}
 
 	// Добавляем новые категории
 	for _, categoryID := range categoryIDs {
-		_, err := app.db.Exec("INSERT INTO shop_categories (shop_id, category_id) VALUES ($1, $2)", shopID, categoryID)
+		_, err := q.ExecContext(ctx, "INSERT INTO shop_categories (shop_id, category_id) VALUES ($1, $2)", shopID, categoryID)
 		if err != nil {
-			return fmt.Errorf("не удалось добавить категорию с ID %d: %v", categoryID, err)
+			return fmt.Errorf("не удалось добавить категорию с ID %d: %w", categoryID, app.translateError(err, categoryID))
+		}
+	}
+	return nil
+}
+
+// GetCategoriesByShopID возвращает категории магазина, упорядоченные по id.
+func (app *App) GetCategoriesByShopID(ctx context.Context, shopID int) ([]Category, error) {
+	if err := checkShopExists(ctx, app.db, shopID); err != nil {
+		return nil, err
+	}
+
+	query := `
+	SELECT c.id, c.name, c.parent_id
+	FROM categories c
+	JOIN shop_categories sc ON sc.category_id = c.id
+	WHERE sc.shop_id = $1
+	ORDER BY c.id`
+
+	rows, err := app.db.QueryContext(ctx, query, shopID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении категорий магазина: %v", err)
+	}
+	defer rows.Close()
+
+	categories := []Category{}
+	for rows.Next() {
+		var category Category
+		if err := rows.Scan(&category.ID, &category.Name, &category.ParentID); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании данных из таблицы categories: %v", err)
 		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка во время обработки строк: %v", err)
 	}
+	return categories, nil
+}
 
+// LinkShopCategory привязывает магазин к категории. Повторная привязка не считается ошибкой.
+func (app *App) LinkShopCategory(ctx context.Context, shopID, categoryID int) error {
+	if err := checkShopExists(ctx, app.db, shopID); err != nil {
+		return err
+	}
+	if _, err := app.GetCategoryByID(ctx, categoryID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO shop_categories (shop_id, category_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	if _, err := app.db.ExecContext(ctx, query, shopID, categoryID); err != nil {
+		return fmt.Errorf("ошибка при добавлении категории %d для магазина %d: %w", categoryID, shopID, app.translateError(err, categoryID))
+	}
+	return nil
+}
+
+// UnlinkShopCategory удаляет привязку магазина к категории.
+func (app *App) UnlinkShopCategory(ctx context.Context, shopID, categoryID int) error {
+	query := `DELETE FROM shop_categories WHERE shop_id = $1 AND category_id = $2`
+	res, err := app.db.ExecContext(ctx, query, shopID, categoryID)
+	if err != nil {
+		return fmt.Errorf("ошибка при удалении категории %d у магазина %d: %v", categoryID, shopID, err)
+	}
+	return checkAffected(res, ErrShopCategoryNotFound)
+}
+
+// validateShop проверяет магазин и существование его категорий через q.
+func (app *App) validateShop(ctx context.Context, q querier, shop Shop, fields map[string]interface{}, categoryIDs []int) error {
+	existing, err := existingCategories(ctx, q, categoryIDs)
+	if err != nil {
+		return err
+	}
+	return validateShop(shop, fields, categoryIDs, existing)
+}
+
+// existingCategories возвращает те из ids, что есть в таблице categories.
+func existingCategories(ctx context.Context, q querier, ids []int) (map[int]bool, error) {
+	existing := make(map[int]bool, len(ids))
+	if len(ids) == 0 {
+		return existing, nil
+	}
+
+	list, args := placeholderList(ids)
+	rows, err := q.QueryContext(ctx, `SELECT id FROM categories WHERE id IN (`+list+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при проверке категорий: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании данных из таблицы categories: %v", err)
+		}
+		existing[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка во время обработки строк: %v", err)
+	}
+	return existing, nil
+}
+
+func checkShopExists(ctx context.Context, q querier, id int) error {
+	var exists int
+	err := q.QueryRowContext(ctx, `SELECT 1 FROM shops WHERE id = $1`, id).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrShopNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке магазина: %v", err)
+	}
+	return nil
+}
+
+// placeholderList возвращает список плейсхолдеров "$1, $2, ..." и аргументы для ids.
+func placeholderList(ids []int) (string, []interface{}) {
+	return appendPlaceholders(nil, ids)
+}
+
+// uniqueBatchIDs убирает повторы, сохраняя порядок, и ограничивает размер пакета.
+func uniqueBatchIDs(ids []int) ([]int, error) {
+	unique := uniqueIDs(ids)
+	if len(unique) > MaxBatchIDs {
+		return nil, ErrTooManyIDs
+	}
+	return unique, nil
+}
+
+// uniqueIDs убирает повторы, сохраняя порядок.
+func uniqueIDs(ids []int) []int {
+	seen := make(map[int]struct{}, len(ids))
+	unique := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		unique = append(unique, id)
+	}
+	return unique
+}
+
+// orderByIDs упорядочивает магазины так же, как ids.
+func orderByIDs(shops []ShopWithCategories, ids []int) []ShopWithCategories {
+	byID := make(map[int]ShopWithCategories, len(shops))
+	for _, shop := range shops {
+		byID[shop.Shop.ID] = shop
+	}
+	ordered := make([]ShopWithCategories, 0, len(shops))
+	for _, id := range ids {
+		if shop, ok := byID[id]; ok {
+			ordered = append(ordered, shop)
+		}
+	}
+	return ordered
+}
+
+// checkAffected возвращает notFound, если запрос не затронул ни одной строки.
+func checkAffected(res sql.Result, notFound error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при получении количества изменённых строк: %v", err)
+	}
+	if n == 0 {
+		return notFound
+	}
 	return nil
 }
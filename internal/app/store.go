@@ -0,0 +1,55 @@
+package app
+
+import "context"
+
+// ShopStore описывает операции над магазинами и их связями с категориями.
+type ShopStore interface {
+	GetShops(ctx context.Context, params ShopListParams) (Page[ShopWithCategories], error)
+	GetShopByID(ctx context.Context, id int) (ShopWithCategories, error)
+	GetShopsByIDs(ctx context.Context, ids []int) ([]ShopWithCategories, error)
+	SearchShops(ctx context.Context, params ShopSearchParams) (Page[ShopWithCategories], error)
+	GetShopFacets(ctx context.Context, params FacetParams) (ShopFacets, error)
+	Suggest(ctx context.Context, prefix string, limit int) ([]Suggestion, error)
+	CreateNewShop(ctx context.Context, shop Shop) (int, error)
+	// CreateShop, ReplaceShop и PatchShop изменяют магазин вместе с его
+	// категориями атомарно: при ошибке данные остаются прежними.
+	CreateShop(ctx context.Context, shop Shop, categoryIDs []int) (int, error)
+	ReplaceShop(ctx context.Context, id string, shop Shop, categoryIDs []int) error
+	PatchShop(ctx context.Context, id string, fields map[string]interface{}, categoryIDs []int) error
+	// ApplyShopPatch вычисляет изменения по текущему состоянию магазина и
+	// сохраняет их так, что между чтением и записью магазин не меняется.
+	ApplyShopPatch(ctx context.Context, id int, patch func(current ShopWithCategories) (ShopPatch, error)) error
+	UpdateShopByID(ctx context.Context, id string, updatedShop Shop) error
+	UpdateShopFields(ctx context.Context, id string, fields map[string]interface{}) error
+	DeleteShopByID(ctx context.Context, id string) error
+	AddShopCategories(ctx context.Context, shopID int, categoryIDs []int) error
+	UpdateShopCategories(ctx context.Context, shopID string, categoryIDs []int) error
+	GetCategoriesByShopID(ctx context.Context, shopID int) ([]Category, error)
+	LinkShopCategory(ctx context.Context, shopID, categoryID int) error
+	UnlinkShopCategory(ctx context.Context, shopID, categoryID int) error
+}
+
+// CategoryStore описывает операции над категориями.
+type CategoryStore interface {
+	GetCategories(ctx context.Context, limit, offset int) (Page[Category], error)
+	GetCategoryByID(ctx context.Context, id int) (Category, error)
+	CreateCategory(ctx context.Context, name string, parentID *int) (Category, error)
+	UpdateCategory(ctx context.Context, id int, update CategoryUpdate) (Category, error)
+	// DeleteCategory не удаляет категорию с подкатегориями
+	DeleteCategory(ctx context.Context, id int) (int, error)
+	GetCategoryTree(ctx context.Context) ([]CategoryNode, error)
+	GetCategoryStats(ctx context.Context, recent int) ([]CategoryStats, error)
+	GetCategoryPath(ctx context.Context, id int) ([]Category, error)
+	GetShopCategories(ctx context.Context) ([]ShopCategory, error)
+}
+
+// Store объединяет все операции хранилища, от которых зависит сервер.
+type Store interface {
+	ShopStore
+	CategoryStore
+}
+
+var (
+	_ Store = (*App)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
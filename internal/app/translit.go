@@ -0,0 +1,131 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// translitTable — транслитерация кириллицы латиницей по ГОСТ 7.79-2000 (система Б).
+// Твёрдый и мягкий знаки опущены: в поисковых формах они только мешают.
+var translitTable = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "j", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "x", 'ц': "cz", 'ч': "ch", 'ш': "sh", 'щ': "shh", 'ъ': "",
+	'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// latinFolding сводит разные способы транслитерации к одной записи: «shch», «sch»
+// и «shh» (щ), «kh», «h» и «x» (х), «ts» и «cz» (ц), «y», «j» и «i» (й, ы, я, ю)
+// становятся одинаковыми. Замены выполняются за один проход, более длинные
+// сочетания указаны раньше коротких.
+var latinFolding = strings.NewReplacer(
+	"shch", "sh", "shh", "sh", "sch", "sh",
+	"kh", "h", "x", "h",
+	"cz", "c", "ts", "c", "tz", "c",
+	"yo", "e", "jo", "e",
+	"y", "i", "j", "i",
+	"w", "v", "q", "k",
+)
+
+// keyboardLayout — клавиши латинской раскладки QWERTY и буквы ЙЦУКЕН на тех же местах.
+var keyboardLayout = map[rune]rune{
+	'q': 'й', 'w': 'ц', 'e': 'у', 'r': 'к', 't': 'е', 'y': 'н', 'u': 'г',
+	'i': 'ш', 'o': 'щ', 'p': 'з', '[': 'х', ']': 'ъ', '{': 'х', '}': 'ъ',
+	'a': 'ф', 's': 'ы', 'd': 'в', 'f': 'а', 'g': 'п', 'h': 'р', 'j': 'о',
+	'k': 'л', 'l': 'д', ';': 'ж', '\'': 'э', ':': 'ж', '"': 'э',
+	'z': 'я', 'x': 'ч', 'c': 'с', 'v': 'м', 'b': 'и', 'n': 'т', 'm': 'ь',
+	',': 'б', '.': 'ю', '<': 'б', '>': 'ю', '`': 'ё', '~': 'ё',
+}
+
+// keyboardLayoutBack — обратное соответствие: буква ЙЦУКЕН и латинская клавиша.
+var keyboardLayoutBack = func() map[rune]rune {
+	back := make(map[rune]rune, len(keyboardLayout))
+	for latin, cyrillic := range keyboardLayout {
+		// Для букв берём строчную клавишу, а не символ с Shift
+		if _, ok := back[cyrillic]; !ok || latin >= 'a' && latin <= 'z' {
+			back[cyrillic] = latin
+		}
+	}
+	return back
+}()
+
+// latinForm переводит слово в латиницу и сводит варианты транслитерации к одной
+// записи: «магазин» и «magazin» дают «magazin», а «щи», «shchi» и «schi» —
+// одинаковое «shi».
+func latinForm(word string) string {
+	var b strings.Builder
+	for _, r := range normalizeSearchText(word) {
+		if latin, ok := translitTable[r]; ok {
+			b.WriteString(latin)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return latinFolding.Replace(b.String())
+}
+
+// switchLayout набирает text так, будто раскладка клавиатуры была другой:
+// «vfufpby» превращается в «магазин», а «сщаауу» — в «coffee».
+func switchLayout(text string) string {
+	var b strings.Builder
+	for _, r := range normalizeSearchText(text) {
+		if switched, ok := keyboardLayout[r]; ok {
+			b.WriteRune(switched)
+		} else if switched, ok := keyboardLayoutBack[r]; ok {
+			b.WriteRune(switched)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// shopSearchForms — поля магазина и столбцы, в которых хранятся их поисковые формы.
+var shopSearchForms = map[string]string{
+	"name":        "name_translit",
+	"description": "description_translit",
+}
+
+// searchForm — поисковая форма текста, которая хранится рядом с магазином:
+// латинские формы всех его слов через пробел.
+func searchForm(text string) string {
+	words := strings.FieldsFunc(text, isWordSeparator)
+	for i, word := range words {
+		words[i] = latinForm(word)
+	}
+	return strings.Join(words, " ")
+}
+
+// fillShopSearchForms заполняет поисковые формы магазинов, созданных до того,
+// как эти формы стали храниться.
+func fillShopSearchForms(ctx context.Context, q querier) error {
+	rows, err := q.QueryContext(ctx, `SELECT id, name, description FROM shops`)
+	if err != nil {
+		return fmt.Errorf("ошибка при чтении магазинов: %v", err)
+	}
+	defer rows.Close()
+
+	var shops []Shop
+	for rows.Next() {
+		var shop Shop
+		if err := rows.Scan(&shop.ID, &shop.Name, &shop.Description); err != nil {
+			return fmt.Errorf("ошибка при сканировании магазина: %v", err)
+		}
+		shops = append(shops, shop)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка во время обработки строк: %v", err)
+	}
+	rows.Close()
+
+	for _, shop := range shops {
+		_, err := q.ExecContext(ctx, `UPDATE shops SET name_translit = $1, description_translit = $2 WHERE id = $3`,
+			searchForm(shop.Name), searchForm(shop.Description), shop.ID)
+		if err != nil {
+			return fmt.Errorf("ошибка при обновлении магазина %d: %v", shop.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package app
+
+import "testing"
+
+func TestLatinForm(t *testing.T) {
+	// Слова в одной строке должны давать одну и ту же латинскую форму
+	tests := []struct {
+		words []string
+		want  string
+	}{
+		{[]string{"магазин", "Магазин", "magazin", "MAGAZIN"}, "magazin"},
+		{[]string{"щи", "shchi", "schi", "shhi"}, "shi"},
+		{[]string{"хлеб", "khleb", "hleb", "xleb"}, "hleb"},
+		{[]string{"цветы", "cvety", "tsvety", "czvety"}, "cveti"},
+		{[]string{"ёлка", "елка", "yolka", "jolka"}, "elka"},
+		{[]string{"кофейня", "kofejnya", "kofeinia", "kofeynya"}, "kofeinia"},
+		{[]string{"подъезд", "podezd"}, "podezd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			for _, word := range tt.words {
+				if got := latinForm(word); got != tt.want {
+					t.Errorf("latinForm(%q) = %q, ожидается %q", word, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSwitchLayout(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"vfufpby", "магазин"},
+		{"VFUFPBY", "магазин"},
+		{"[kt,", "хлеб"},
+		{"сщаауу", "coffee"},
+		{"rjat 24", "кофе 24"},
+		// Символы, которых нет на клавиатуре, остаются как есть
+		{"№-1", "№-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := switchLayout(tt.text); got != tt.want {
+				t.Errorf("switchLayout(%q) = %q, ожидается %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchForm(t *testing.T) {
+	if got, want := searchForm("Кофейня «Бодрое утро», 24/7"), "kofeinia bodroe utro 24 7"; got != want {
+		t.Errorf("searchForm = %q, ожидается %q", got, want)
+	}
+}
+
+func TestMatchShopFolding(t *testing.T) {
+	shops := []Shop{
+		{ID: 1, Name: "Книжный магазин Буква", Description: "Книги и канцелярия"},
+		{ID: 2, Name: "Пекарня", Description: "Хлеб, свежая выпечка и кофе с собой"},
+		{ID: 3, Name: "Щи да каша", Description: "Домашняя кухня"},
+	}
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"магазин", []int{1}},
+		{"магазины", []int{1}},
+		{"magazin", []int{1}},
+		{"vfufpby", []int{1}},
+		{"Bukva magazin", []int{1}},
+		{"pekarnya", []int{2}},
+		{"[kt,", []int{2}},
+		{"кофе", []int{2}},
+		{"rjat", []int{2}},
+		{"shchi", []int{3}},
+		{"schi", []int{3}},
+		{"магазин кофе", nil},
+		{"электроника", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			terms := searchTerms(tt.query)
+			var got []int
+			for _, shop := range shops {
+				if _, _, ok := matchShop(shop, terms); ok {
+					got = append(got, shop.ID)
+				}
+			}
+			if !equalInts(got, tt.want) {
+				t.Errorf("найдены магазины %v, ожидаются %v", got, tt.want)
+			}
+		})
+	}
+}
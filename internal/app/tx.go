@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// querier — общие методы *sql.DB и *sql.Tx. Вспомогательные функции принимают
+// querier, чтобы их можно было вызывать как отдельно, так и внутри транзакции.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// withTx выполняет fn в одной транзакции: фиксирует её, если fn вернула nil,
+// и откатывает при ошибке или панике. Внутри fn нельзя обращаться к app.db:
+// у SQLite одно соединение, и запрос мимо транзакции будет ждать её вечно.
+func (app *App) withTx(ctx context.Context, fn func(tx querier) error) error {
+	tx, err := app.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при подтверждении транзакции: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Ограничения на данные магазинов и категорий.
+const (
+	MaxShopNameLength        = 100
+	MaxShopDescriptionLength = 2000
+	MaxShopImageLength       = 500
+	MinShopPrice             = 0
+	MaxShopPrice             = 100_000_000
+	MaxCategoryNameLength    = 64
+	MaxShopCategories        = 20
+)
+
+// rule — правило проверки одного поля значения типа T. check возвращает nil,
+// если значение корректно.
+type rule[T any] struct {
+	field string
+	check func(v T) *FieldError
+}
+
+// shopRules описывают корректный магазин. Правила проверяют поля независимо,
+// поэтому ошибки всех полей можно вернуть одним ответом.
+var shopRules = []rule[Shop]{
+	lengthRule("name", func(s Shop) string { return s.Name }, 1, MaxShopNameLength),
+	imageRule("image", func(s Shop) string { return s.Image }),
+	rangeRule("price", func(s Shop) int { return s.Price }, MinShopPrice, MaxShopPrice),
+	lengthRule("description", func(s Shop) string { return s.Description }, 0, MaxShopDescriptionLength),
+}
+
+// categoryRules описывают корректную категорию.
+var categoryRules = []rule[Category]{
+	lengthRule("name", func(c Category) string { return c.Name }, 1, MaxCategoryNameLength),
+}
+
+// validate применяет правила к v. Если fields не nil, проверяются только
+// перечисленные в нём поля: так PATCH не спотыкается о старые данные.
+func validate[T any](v T, rules []rule[T], fields map[string]interface{}) []FieldError {
+	var errs []FieldError
+	for _, r := range rules {
+		if fields != nil {
+			if _, ok := fields[r.field]; !ok {
+				continue
+			}
+		}
+		if err := r.check(v); err != nil {
+			errs = append(errs, *err)
+		}
+	}
+	return errs
+}
+
+func lengthRule[T any](field string, get func(T) string, min, max int) rule[T] {
+	return rule[T]{field: field, check: func(v T) *FieldError {
+		n := utf8.RuneCountInString(strings.TrimSpace(get(v)))
+		switch {
+		case n == 0 && min > 0:
+			return &FieldError{Field: field, Code: "required", Message: "обязательное поле"}
+		case n < min:
+			return &FieldError{Field: field, Code: "too_short", Message: fmt.Sprintf("не короче %d символов", min)}
+		case n > max:
+			return &FieldError{Field: field, Code: "too_long", Message: fmt.Sprintf("не длиннее %d символов", max)}
+		}
+		return nil
+	}}
+}
+
+func rangeRule[T any](field string, get func(T) int, min, max int) rule[T] {
+	return rule[T]{field: field, check: func(v T) *FieldError {
+		if n := get(v); n < min || n > max {
+			return &FieldError{
+				Field:   field,
+				Code:    "out_of_range",
+				Message: fmt.Sprintf("значение должно быть от %d до %d", min, max),
+			}
+		}
+		return nil
+	}}
+}
+
+// imagePath — относительный путь к файлу изображения, например images/shop_1.jpg.
+var imagePath = regexp.MustCompile(`(?i)^[\p{L}\p{N}_\-./]+\.(jpe?g|png|gif|webp)$`)
+
+// imageRule принимает ссылку http(s) или относительный путь к изображению.
+func imageRule[T any](field string, get func(T) string) rule[T] {
+	return rule[T]{field: field, check: func(v T) *FieldError {
+		image := get(v)
+		switch {
+		case image == "":
+			return &FieldError{Field: field, Code: "required", Message: "обязательное поле"}
+		case len(image) > MaxShopImageLength:
+			return &FieldError{Field: field, Code: "too_long", Message: fmt.Sprintf("не длиннее %d символов", MaxShopImageLength)}
+		}
+
+		if u, err := url.Parse(image); err == nil && u.Scheme != "" {
+			if (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+				return nil
+			}
+			return &FieldError{Field: field, Code: "invalid_format", Message: "ожидается ссылка http(s) или путь к изображению"}
+		}
+		if !imagePath.MatchString(image) || strings.HasPrefix(image, "/") || path.Clean(image) != image {
+			return &FieldError{Field: field, Code: "invalid_format", Message: "ожидается ссылка http(s) или путь к изображению"}
+		}
+		return nil
+	}}
+}
+
+// categorySetErrors проверяет набор категорий магазина: размер, повторы и
+// существование. existing содержит идентификаторы существующих категорий.
+func categorySetErrors(categoryIDs []int, existing map[int]bool) []FieldError {
+	var errs []FieldError
+	if len(categoryIDs) > MaxShopCategories {
+		errs = append(errs, FieldError{
+			Field:   "categories",
+			Code:    "too_many",
+			Message: fmt.Sprintf("не больше %d категорий", MaxShopCategories),
+		})
+	}
+
+	seen := make(map[int]bool, len(categoryIDs))
+	for _, id := range categoryIDs {
+		switch {
+		case seen[id]:
+			errs = append(errs, FieldError{Field: "categories", Code: "duplicate", Message: fmt.Sprintf("категория с ID %d указана повторно", id)})
+		case !existing[id]:
+			errs = append(errs, FieldError{Field: "categories", Code: "not_found", Message: fmt.Sprintf("категория с ID %d не существует", id)})
+		}
+		seen[id] = true
+	}
+	return errs
+}
+
+// normalizeShop обрезает пробелы по краям строковых полей магазина. Правила
+// длины считают символы без этих пробелов, поэтому сохраняется то же, что проверено.
+func normalizeShop(shop Shop) Shop {
+	shop.Name = strings.TrimSpace(shop.Name)
+	shop.Image = strings.TrimSpace(shop.Image)
+	shop.Description = strings.TrimSpace(shop.Description)
+	return shop
+}
+
+// validateShop проверяет магазин и набор его категорий. fields ограничивает
+// проверку полей магазина, как в validate; nil categoryIDs не проверяются.
+func validateShop(shop Shop, fields map[string]interface{}, categoryIDs []int, existing map[int]bool) error {
+	errs := validate(shop, shopRules, fields)
+	if categoryIDs != nil {
+		errs = append(errs, categorySetErrors(categoryIDs, existing)...)
+	}
+	if len(errs) > 0 {
+		return NewValidationError(errs...)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+// fieldCodes возвращает ошибки полей в виде «поле: код».
+func fieldCodes(errs []FieldError) []string {
+	codes := []string{}
+	for _, e := range errs {
+		codes = append(codes, e.Field+": "+e.Code)
+	}
+	return codes
+}
+
+func TestValidateShop(t *testing.T) {
+	valid := Shop{Name: "Пекарня", Image: "images/shop_1.jpg", Price: 200, Description: "Хлеб и выпечка"}
+	tests := []struct {
+		name   string
+		modify func(s *Shop)
+		want   []string
+	}{
+		{"корректный магазин", func(s *Shop) {}, nil},
+		{"ссылка на изображение", func(s *Shop) { s.Image = "https://cdn.example.com/shop.png" }, nil},
+		{"пустое описание", func(s *Shop) { s.Description = "" }, nil},
+		{"название из пробелов", func(s *Shop) { s.Name = "   " }, []string{"name: required"}},
+		{"длинное название", func(s *Shop) { s.Name = strings.Repeat("я", MaxShopNameLength+1) }, []string{"name: too_long"}},
+		{"название предельной длины", func(s *Shop) { s.Name = strings.Repeat("я", MaxShopNameLength) }, nil},
+		{"отрицательная цена", func(s *Shop) { s.Price = -1 }, []string{"price: out_of_range"}},
+		{"слишком большая цена", func(s *Shop) { s.Price = MaxShopPrice + 1 }, []string{"price: out_of_range"}},
+		{"без изображения", func(s *Shop) { s.Image = "" }, []string{"image: required"}},
+		{"абсолютный путь", func(s *Shop) { s.Image = "/etc/shop.jpg" }, []string{"image: invalid_format"}},
+		{"выход из каталога", func(s *Shop) { s.Image = "images/../../shop.jpg" }, []string{"image: invalid_format"}},
+		{"не изображение", func(s *Shop) { s.Image = "images/shop.exe" }, []string{"image: invalid_format"}},
+		{"ссылка не http", func(s *Shop) { s.Image = "ftp://example.com/shop.jpg" }, []string{"image: invalid_format"}},
+		{
+			"все ошибки сразу",
+			func(s *Shop) { s.Name = ""; s.Image = ""; s.Price = -1 },
+			[]string{"name: required", "image: required", "price: out_of_range"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shop := valid
+			tt.modify(&shop)
+			got := fieldCodes(validate(shop, shopRules, nil))
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("ошибки %q, ожидаются %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateShopPartial(t *testing.T) {
+	// При частичном изменении проверяются только переданные поля
+	shop := Shop{Name: "", Image: "", Price: -1}
+	got := fieldCodes(validate(shop, shopRules, map[string]interface{}{"price": -1}))
+	if strings.Join(got, ", ") != "price: out_of_range" {
+		t.Errorf("ошибки %q, ожидается только price", got)
+	}
+}
+
+func TestCategorySetErrors(t *testing.T) {
+	existing := map[int]bool{1: true, 2: true}
+	many := make([]int, MaxShopCategories+1)
+	for i := range many {
+		many[i] = i + 100
+		existing[i+100] = true
+	}
+	tests := []struct {
+		name string
+		ids  []int
+		want []string
+	}{
+		{"корректный набор", []int{1, 2}, nil},
+		{"пустой набор", []int{}, nil},
+		{"повтор", []int{1, 2, 1}, []string{"categories: duplicate"}},
+		{"несуществующая", []int{1, 3}, []string{"categories: not_found"}},
+		{"слишком много", many, []string{"categories: too_many"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fieldCodes(categorySetErrors(tt.ids, existing))
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("ошибки %q, ожидаются %q", got, tt.want)
+			}
+		})
+	}
+}
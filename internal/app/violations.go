@@ -0,0 +1,131 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// violationKind — нарушенное ограничение СУБД.
+type violationKind int
+
+const (
+	violationNone violationKind = iota
+	violationForeignKey
+	violationUnique
+	violationNotNull
+	violationInvalidText
+	violationUndefinedColumn
+)
+
+// violation описывает нарушение ограничения. PostgreSQL сообщает столбец и значение,
+// SQLite — только вид ограничения, поэтому column и value могут быть пустыми.
+type violation struct {
+	kind   violationKind
+	column string
+	value  string
+}
+
+// pgKeyDetail разбирает Detail вида `Key (category_id)=(99) is not present in table "categories".`
+var pgKeyDetail = regexp.MustCompile(`^Key \(([^)]+)\)=\((.*)\)`)
+
+func pgViolation(err error) violation {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return violation{}
+	}
+
+	v := violation{column: pqErr.Column}
+	if m := pgKeyDetail.FindStringSubmatch(pqErr.Detail); m != nil {
+		v.column, v.value = m[1], m[2]
+	}
+
+	switch pqErr.Code {
+	case "23503": // foreign_key_violation
+		v.kind = violationForeignKey
+	case "23505": // unique_violation
+		v.kind = violationUnique
+	case "23502": // not_null_violation
+		v.kind = violationNotNull
+	case "22P02": // invalid_text_representation
+		v.kind = violationInvalidText
+	case "42703": // undefined_column
+		v.kind = violationUndefinedColumn
+	}
+	return v
+}
+
+func sqliteViolation(err error) violation {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return violation{}
+	}
+
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return violation{kind: violationForeignKey}
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return violation{kind: violationUnique}
+	case sqlite3.SQLITE_CONSTRAINT_NOTNULL:
+		// Сообщение имеет вид "NOT NULL constraint failed: shops.name"
+		msg := sqliteErr.Error()
+		column := msg[strings.LastIndex(msg, ".")+1:]
+		if i := strings.IndexAny(column, " )"); i >= 0 {
+			column = column[:i]
+		}
+		return violation{kind: violationNotNull, column: column}
+	case sqlite3.SQLITE_MISMATCH:
+		return violation{kind: violationInvalidText}
+	}
+	return violation{}
+}
+
+// translateError превращает нарушение ограничения в ошибку предметной области.
+// Текст ошибки драйвера в неё не попадает, чтобы не раскрывать клиенту схему.
+// categoryID — категория, которую привязывал запрос: SQLite не сообщает значение
+// внешнего ключа, поэтому оно берётся из контекста. Прочие ошибки возвращаются как есть.
+func (app *App) translateError(err error, categoryID int) error {
+	if err == nil {
+		return nil
+	}
+
+	v := app.dialect.violation(err)
+	switch v.kind {
+	case violationForeignKey:
+		if v.column == "shop_id" {
+			return ErrShopNotFound
+		}
+		id := categoryID
+		if parsed, convErr := strconv.Atoi(v.value); convErr == nil {
+			id = parsed
+		}
+		return newForeignKeyError(id)
+	case violationUnique:
+		switch v.column {
+		case "name":
+			return ErrCategoryExists
+		case "shop_id, category_id", "":
+			if categoryID > 0 {
+				return ErrShopCategoryExists
+			}
+		}
+		return &Error{Kind: KindConflict, Code: "conflict", Message: "запись нарушает ограничение уникальности"}
+	case violationNotNull:
+		return NewValidationError(FieldError{Field: v.column, Code: "required", Message: "обязательное поле"})
+	case violationInvalidText:
+		field := FieldError{Field: v.column, Code: "invalid_value", Message: "некорректное значение"}
+		if v.value != "" {
+			field.Message = fmt.Sprintf("некорректное значение %q", v.value)
+		}
+		return NewValidationError(field)
+	case violationUndefinedColumn:
+		return NewValidationError(FieldError{Field: v.column, Code: "unknown_field", Message: "неизвестное поле"})
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+// Package logging настраивает журнал на основе log/slog и добавляет в записи
+// атрибуты текущего запроса: идентификатор, маршрут, идентификаторы из пути.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// Форматы журнала.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// New создаёт журнал, пишущий в w в формате format. Уровень level можно менять
+// во время работы, если передать *slog.LevelVar. Записи, сделанные с контекстом
+// запроса (InfoContext и т. п.), получают атрибуты, добавленные через AddAttrs.
+func New(w io.Writer, format string, level slog.Leveler) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if format == FormatJSON {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+type contextKey struct{}
+
+// requestLog — журнал запроса и атрибуты, которые обработчики добавляют по ходу
+// обработки. Атрибуты защищены мьютексом: запрос может порождать горутины.
+type requestLog struct {
+	logger *slog.Logger
+	mu     sync.Mutex
+	attrs  []slog.Attr
+}
+
+// NewContext возвращает контекст запроса с журналом logger и пустым набором атрибутов.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestLog{logger: logger})
+}
+
+// FromContext возвращает журнал из контекста или slog.Default(), если его там нет.
+func FromContext(ctx context.Context) *slog.Logger {
+	if rl, ok := ctx.Value(contextKey{}).(*requestLog); ok && rl.logger != nil {
+		return rl.logger
+	}
+	return slog.Default()
+}
+
+// AddAttrs добавляет атрибуты ко всем последующим записям с этим контекстом.
+// Атрибут с уже добавленным ключом заменяет прежний. Без NewContext ничего не делает.
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	rl, ok := ctx.Value(contextKey{}).(*requestLog)
+	if !ok {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+next:
+	for _, attr := range attrs {
+		for i := range rl.attrs {
+			if rl.attrs[i].Key == attr.Key {
+				rl.attrs[i] = attr
+				continue next
+			}
+		}
+		rl.attrs = append(rl.attrs, attr)
+	}
+}
+
+// attrsFromContext возвращает копию атрибутов запроса.
+func attrsFromContext(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	rl, ok := ctx.Value(contextKey{}).(*requestLog)
+	if !ok {
+		return nil
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return append([]slog.Attr(nil), rl.attrs...)
+}
+
+// contextHandler дописывает в каждую запись атрибуты запроса из контекста.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	record.AddAttrs(attrsFromContext(ctx)...)
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
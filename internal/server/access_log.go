@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Форматы журнала запросов.
+const (
+	// AccessLogCLF — Common Log Format, дополненный длительностью и идентификатором запроса
+	AccessLogCLF = "clf"
+	// AccessLogJSON — одна JSON-запись на строку
+	AccessLogJSON = "json"
+	// AccessLogOff отключает журнал запросов
+	AccessLogOff = "off"
+)
+
+// accessEntry — запись журнала запросов.
+type accessEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	LatencyMS  float64   `json:"latency_ms"`
+	RequestID  string    `json:"request_id"`
+}
+
+// accessLog пишет в w по строке на каждый запрос в формате format.
+// Должен стоять после withRequestID, чтобы в записи был идентификатор запроса.
+func accessLog(w io.Writer, format string) middleware {
+	if format == AccessLogOff {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	// log.Logger не даёт строкам одновременных запросов перемешаться
+	logger := log.New(w, "", 0)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := newResponseRecorder(w)
+			defer func() {
+				entry := accessEntry{
+					Time:       start,
+					RemoteAddr: r.RemoteAddr,
+					Method:     r.Method,
+					Path:       r.URL.RequestURI(),
+					Proto:      r.Proto,
+					Status:     rec.status,
+					Bytes:      rec.bytes,
+					LatencyMS:  float64(time.Since(start).Microseconds()) / 1000,
+					RequestID:  RequestID(r.Context()),
+				}
+				if entry.Status == 0 {
+					// Обработчик ничего не записал: net/http ответит 200 с пустым телом
+					entry.Status = http.StatusOK
+				}
+				if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+					entry.RemoteAddr = host
+				}
+				logger.Print(formatAccessEntry(entry, format))
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// formatAccessEntry записывает entry в формате format.
+func formatAccessEntry(entry accessEntry, format string) string {
+	if format == AccessLogJSON {
+		line, _ := json.Marshal(entry)
+		return string(line)
+	}
+	// host ident authuser [date] "request" status bytes, затем длительность и id запроса
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = fmt.Sprint(entry.Bytes)
+	}
+	return fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %s %.3fms %s`,
+		entry.RemoteAddr, entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		entry.Method, entry.Path, entry.Proto, entry.Status, bytes, entry.LatencyMS, entry.RequestID)
+}
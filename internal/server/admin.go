@@ -0,0 +1,62 @@
+package server
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+	"test-server/internal/logging"
+)
+
+// logLevelBody — тело запроса и ответа /admin/log-level.
+type logLevelBody struct {
+	Level string `json:"level"`
+}
+
+// requireAdmin пропускает запрос, только если в заголовке Authorization
+// передан токен adminToken: "Authorization: Bearer <токен>".
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeProblem(w, r, Problem{
+				Status: http.StatusUnauthorized,
+				Code:   "unauthorized",
+				Detail: "требуется токен администратора",
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// GetHandlerLogLevel возвращает текущий уровень журнала.
+func (s *Server) GetHandlerLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, logLevelBody{Level: levelName(s.logLevel.Level())})
+}
+
+// PutHandlerLogLevel меняет уровень журнала без перезапуска сервера.
+func (s *Server) PutHandlerLogLevel(w http.ResponseWriter, r *http.Request) {
+	var body logLevelBody
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(body.Level)); err != nil {
+		badRequest(w, r, "invalid_level", "ожидается уровень debug, info, warn или error, получено "+body.Level)
+		return
+	}
+
+	previous := s.logLevel.Level()
+	s.logLevel.Set(level)
+	// Запись уровня warn видна при любом уровне, кроме error
+	logging.FromContext(r.Context()).WarnContext(r.Context(), "уровень журнала изменён",
+		"from", levelName(previous), "to", levelName(level))
+	writeJSON(w, r, http.StatusOK, logLevelBody{Level: levelName(level)})
+}
+
+// levelName возвращает уровень в том виде, в котором он задаётся в настройках.
+func levelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
@@ -2,26 +2,261 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"test-server/internal/app"
 )
 
-func (s *Server) HandlerCategories(w http.ResponseWriter, r *http.Request) {
+type CategoryRequest struct {
+	Name *string `json:"name"`
+	// ParentID — родительская категория; null делает категорию корневой
+	ParentID nullableInt `json:"parent_id"`
+}
+
+// nullableInt — необязательное число, которое можно явно сбросить в null.
+// Set показывает, было ли поле в теле запроса.
+type nullableInt struct {
+	Set   bool
+	Value *int
+}
 
-	categories, err := s.App.GetCategories()
+func (n *nullableInt) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	return json.Unmarshal(data, &n.Value)
+}
+
+type DeleteCategoryResponse struct {
+	ID               int `json:"id"`
+	RemovedShopLinks int `json:"removed_shop_links"`
+}
+
+func (s *Server) GetHandlerCategories(w http.ResponseWriter, r *http.Request) {
+	// Получаем параметры пагинации так же, как для магазинов
+	limit, offset, err := pageParams(r)
 	if err != nil {
-		fmt.Println(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
 	}
-	fmt.Println(categories)
 
-	respjson, err := json.Marshal(categories)
+	categories, err := s.App.GetCategories(r.Context(), limit, offset)
 	if err != nil {
-		fmt.Println(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write(respjson)
+	writeJSON(w, r, http.StatusOK, categories)
+}
+
+// GetHandlerCategoryShops возвращает магазины категории с той же пагинацией, что и список магазинов.
+func (s *Server) GetHandlerCategoryShops(w http.ResponseWriter, r *http.Request) {
+	id, ok := categoryIDParam(w, r)
+	if !ok {
+		return
+	}
 
+	// Отличаем пустую категорию от несуществующей
+	if _, err := s.App.GetCategoryByID(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// Категория из пути заменяет отбор category_id; остальные параметры — как у списка
+	list, err := parseShopListRequest(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	list.params.Categories.IDs = []int{id}
+	s.writeShopList(w, r, list)
+}
+
+func (s *Server) GetHandlerCategory(w http.ResponseWriter, r *http.Request) {
+	id, ok := categoryIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	category, err := s.App.GetCategoryByID(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, category)
+}
+
+func (s *Server) PostHandlerCategories(w http.ResponseWriter, r *http.Request) {
+	var request CategoryRequest
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+	if request.Name == nil {
+		writeError(w, r, app.ErrInvalidCategoryName)
+		return
+	}
+
+	category, err := s.App.CreateCategory(r.Context(), *request.Name, request.ParentID.Value)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/categories/%d", category.ID))
+	writeJSON(w, r, http.StatusCreated, category)
+}
+
+// UpdateHandlerCategory обрабатывает PUT и PATCH. PUT заменяет категорию
+// целиком: name обязателен, а без parent_id категория становится корневой.
+// PATCH меняет только переданные поля.
+func (s *Server) UpdateHandlerCategory(w http.ResponseWriter, r *http.Request) {
+	id, ok := categoryIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var request CategoryRequest
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+
+	update := app.CategoryUpdate{Name: request.Name, SetParent: request.ParentID.Set, ParentID: request.ParentID.Value}
+	if r.Method == http.MethodPut {
+		if request.Name == nil {
+			writeError(w, r, app.ErrInvalidCategoryName)
+			return
+		}
+		update.SetParent = true
+	}
+
+	category, err := s.App.UpdateCategory(r.Context(), id, update)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, category)
+}
+
+// GetHandlerCategoryTree возвращает все категории в виде дерева.
+func (s *Server) GetHandlerCategoryTree(w http.ResponseWriter, r *http.Request) {
+	tree, err := s.App.GetCategoryTree(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, tree)
+}
+
+// GetHandlerCategoryStats возвращает статистику по всем категориям:
+// количество магазинов, цены и ?recent= последних добавленных магазинов.
+func (s *Server) GetHandlerCategoryStats(w http.ResponseWriter, r *http.Request) {
+	recent := app.DefaultRecentShops
+	if n, err := strconv.Atoi(r.URL.Query().Get("recent")); err == nil && n >= 0 {
+		recent = min(n, app.MaxRecentShops)
+	}
+
+	stats, err := s.App.GetCategoryStats(r.Context(), recent)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, app.Page[app.CategoryStats]{Items: stats, Total: len(stats)})
+}
+
+// GetHandlerCategoryBreadcrumbs возвращает путь от корневой категории до указанной.
+func (s *Server) GetHandlerCategoryBreadcrumbs(w http.ResponseWriter, r *http.Request) {
+	id, ok := categoryIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	path, err := s.App.GetCategoryPath(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, path)
+}
+
+func (s *Server) DeleteHandlerCategory(w http.ResponseWriter, r *http.Request) {
+	id, ok := categoryIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	links, err := s.App.DeleteCategory(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, DeleteCategoryResponse{ID: id, RemovedShopLinks: links})
+}
+
+// categoryIDParam разбирает id категории из пути и при ошибке сам отвечает 400.
+func categoryIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	return pathID(w, r, "id")
+}
+
+// pathID разбирает числовой параметр пути name и при ошибке сам отвечает 400.
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	value := r.PathValue(name)
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		writeError(w, r, app.ErrInvalidID.With("некорректный идентификатор %q", value))
+		return 0, false
+	}
+	return id, true
+}
+
+// maxBodyBytes — наибольший размер тела запроса.
+const maxBodyBytes = 64 << 10
+
+// decodeJSON читает тело запроса в v, отклоняя неизвестные поля.
+// При ошибке сам отвечает клиенту и возвращает false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	return decodeBody(w, r, v, true)
+}
+
+// decodeBody читает из тела ровно одно JSON-значение не больше maxBodyBytes.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}, strict bool) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	decoder := json.NewDecoder(r.Body)
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+
+	err := decoder.Decode(v)
+	if err == nil && decoder.More() {
+		err = errors.New("после JSON-значения есть лишние данные")
+	}
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeProblem(w, r, Problem{
+			Status: http.StatusRequestEntityTooLarge,
+			Code:   "body_too_large",
+			Detail: fmt.Sprintf("тело запроса больше %d байт", tooLarge.Limit),
+		})
+		return false
+	case err != nil:
+		badRequest(w, r, "invalid_json", "ошибка декодирования данных: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeJSON кодирует v в JSON и отправляет его с указанным статусом.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	respjson, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("ошибка при преобразовании данных в JSON: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(respjson)
 }
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"test-server/internal/app"
+	"testing"
+)
+
+func TestCategoryCRUD(t *testing.T) {
+	ts := newTestServer(t, Options{})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		// code — код ошибки; для успешного ответа пуст
+		code string
+		want string
+	}{
+		{"создание", http.MethodPost, "/api/v1/categories", `{"name":"  Хлеб  "}`, http.StatusCreated, "", "Хлеб"},
+		{"повторное название", http.MethodPost, "/api/v1/categories", `{"name":"Хлеб"}`, http.StatusConflict, "category_exists", ""},
+		{"без названия", http.MethodPost, "/api/v1/categories", `{}`, http.StatusBadRequest, "invalid_category_name", ""},
+		{"получение", http.MethodGet, "/api/v1/categories/7", "", http.StatusOK, "", "Хлеб"},
+		{"переименование", http.MethodPut, "/api/v1/categories/7", `{"name":"Выпечка"}`, http.StatusOK, "", "Выпечка"},
+		{"переименование в занятое", http.MethodPatch, "/api/v1/categories/7", `{"name":"Категория 1"}`, http.StatusConflict, "category_exists", ""},
+		{"несуществующая", http.MethodGet, "/api/v1/categories/99", "", http.StatusNotFound, "category_not_found", ""},
+		{"некорректный id", http.MethodGet, "/api/v1/categories/x", "", http.StatusBadRequest, "invalid_id", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := ts.do(t, tt.method, tt.path, "", tt.body)
+			if tt.code != "" {
+				checkProblem(t, w, tt.status, tt.code)
+				return
+			}
+			var category app.Category
+			decodeResponse(t, w, tt.status, &category)
+			if category.Name != tt.want {
+				t.Errorf("название %q, ожидается %q", category.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteCategory(t *testing.T) {
+	ts := newTestServer(t, Options{})
+	bakery := ts.createShop(t, "Пекарня", 200, 1, 2)
+	ts.createShop(t, "Книжный", 500, 2, 3)
+
+	// Удаление категории удаляет её связи с магазинами
+	var deleted DeleteCategoryResponse
+	decodeResponse(t, ts.do(t, http.MethodDelete, "/api/v1/categories/2", "", ""), http.StatusOK, &deleted)
+	if deleted.ID != 2 || deleted.RemovedShopLinks != 2 {
+		t.Errorf("получено %+v, ожидается удаление двух связей категории 2", deleted)
+	}
+	if got := categoryIDs(ts.shop(t, bakery)); !equalInts(got, []int{1}) {
+		t.Errorf("категории пекарни %v, ожидается [1]", got)
+	}
+	checkProblem(t, ts.do(t, http.MethodDelete, "/api/v1/categories/2", "", ""), http.StatusNotFound, "category_not_found")
+	checkProblem(t, ts.do(t, http.MethodGet, "/api/v1/categories/2", "", ""), http.StatusNotFound, "category_not_found")
+}
+
+func TestCategoryHierarchy(t *testing.T) {
+	ts := newTestServer(t, Options{})
+	bakery := ts.createShop(t, "Пекарня", 200, 1, 2)
+
+	// 2 → 7 → 8
+	for _, body := range []string{`{"name":"Хлеб","parent_id":2}`, `{"name":"Батоны","parent_id":7}`} {
+		if w := ts.do(t, http.MethodPost, "/api/v1/categories", "", body); w.Code != http.StatusCreated {
+			t.Fatalf("создание подкатегории: статус %d: %s", w.Code, w.Body)
+		}
+	}
+
+	var path []app.Category
+	decodeResponse(t, ts.do(t, http.MethodGet, "/api/v1/categories/8/breadcrumbs", "", ""), http.StatusOK, &path)
+	if got := categoryIDsOf(path); !equalInts(got, []int{2, 7, 8}) {
+		t.Errorf("путь к категории %v, ожидается [2 7 8]", got)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"в свою подкатегорию", http.MethodPatch, "/api/v1/categories/2", `{"parent_id":8}`, http.StatusBadRequest, "validation_failed"},
+		{"в саму себя", http.MethodPatch, "/api/v1/categories/7", `{"parent_id":7}`, http.StatusBadRequest, "validation_failed"},
+		{"в несуществующую", http.MethodPatch, "/api/v1/categories/7", `{"parent_id":99}`, http.StatusBadRequest, "validation_failed"},
+		{"удаление категории с подкатегориями", http.MethodDelete, "/api/v1/categories/2", "", http.StatusConflict, "category_has_children"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkProblem(t, ts.do(t, tt.method, tt.path, "", tt.body), tt.status, tt.code)
+		})
+	}
+	if got := categoryIDs(ts.shop(t, bakery)); !equalInts(got, []int{1, 2}) {
+		t.Errorf("после отказа в удалении категории магазина %v", got)
+	}
+
+	// Перенос в корень укорачивает путь
+	if w := ts.do(t, http.MethodPatch, "/api/v1/categories/7", "", `{"parent_id":null}`); w.Code != http.StatusOK {
+		t.Fatalf("перенос в корень: статус %d: %s", w.Code, w.Body)
+	}
+	decodeResponse(t, ts.do(t, http.MethodGet, "/api/v1/categories/8/breadcrumbs", "", ""), http.StatusOK, &path)
+	if got := categoryIDsOf(path); !equalInts(got, []int{7, 8}) {
+		t.Errorf("путь после переноса %v, ожидается [7 8]", got)
+	}
+}
+
+func TestCategoryShops(t *testing.T) {
+	ts := newTestServer(t, Options{})
+	ts.createShop(t, "Пекарня", 100, 1, 2)
+	ts.createShop(t, "Книжный", 300, 2)
+	ts.createShop(t, "Цветы", 200, 3)
+	ts.createShop(t, "Булочная", 50, 2, 4)
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  []int
+	}{
+		{"вся категория", url.Values{"sort": {"id"}}, []int{1, 2, 4}},
+		{"сортировка по цене", url.Values{"sort": {"price"}}, []int{4, 1, 2}},
+		{"фильтр по цене", url.Values{"sort": {"id"}, "min_price": {"100"}}, []int{1, 2}},
+		{"исключение категории", url.Values{"sort": {"id"}, "exclude_category_id": {"4"}}, []int{1, 2}},
+		{"category_id из запроса не заменяет категорию пути", url.Values{"sort": {"id"}, "category_id": {"3"}}, []int{1, 2, 4}},
+		{"поиск", url.Values{"q": {"булочная"}}, []int{4}},
+		{"страница", url.Values{"sort": {"id"}, "limit": {"2"}, "page": {"2"}}, []int{4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var page app.Page[app.ShopWithCategories]
+			decodeResponse(t, ts.do(t, http.MethodGet, "/api/v1/categories/2/shops?"+tt.query.Encode(), "", ""), http.StatusOK, &page)
+			if got := shopIDs(page); !equalInts(got, tt.want) {
+				t.Errorf("магазины %v, ожидаются %v", got, tt.want)
+			}
+		})
+	}
+
+	checkProblem(t, ts.do(t, http.MethodGet, "/api/v1/categories/99/shops", "", ""), http.StatusNotFound, "category_not_found")
+	checkProblem(t, ts.do(t, http.MethodGet, "/api/v1/categories/2/shops?min_price=x", "", ""), http.StatusBadRequest, "validation_failed")
+}
+
+func categoryIDsOf(categories []app.Category) []int {
+	ids := []int{}
+	for _, category := range categories {
+		ids = append(ids, category.ID)
+	}
+	return ids
+}
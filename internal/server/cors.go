@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Заголовки CORS: методы API, заголовки запроса и заголовки ответа, которые
+// доступны скриптам в браузере.
+const (
+	corsAllowMethods  = "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsAllowHeaders  = "Content-Type, X-Request-ID"
+	corsExposeHeaders = "Location, Deprecation, Link, Accept-Patch, X-Request-ID"
+	corsMaxAge        = "600"
+)
+
+// cors разрешает запросы из браузера с источников origins; "*" разрешает любой
+// источник. Предварительные запросы OPTIONS с разрешённых источников получают
+// ответ сразу, остальные передаются дальше без заголовков CORS. Пустой список
+// отключает CORS.
+func cors(origins []string) middleware {
+	if len(origins) == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	anyOrigin := false
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			origin := r.Header.Get("Origin")
+			if origin == "" || !(anyOrigin || allowed[origin]) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+				h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+				h.Set("Access-Control-Max-Age", corsMaxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"test-server/internal/logging"
+)
+
+// middleware оборачивает обработчик дополнительной логикой.
+type middleware func(http.Handler) http.Handler
+
+// chain оборачивает h в middlewares так, что первый из них выполняется первым.
+func chain(h http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// withLogger передаёт журнал logger в контекст запроса. Следующие middleware
+// и обработчики добавляют к нему атрибуты запроса через logging.AddAttrs.
+func withLogger(logger *slog.Logger) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(logging.NewContext(r.Context(), logger)))
+		})
+	}
+}
+
+// requestIDHeader — заголовок с идентификатором запроса. Клиент может передать
+// свой идентификатор, иначе сервер создаёт новый; в ответе он возвращается всегда.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength — наибольшая длина идентификатора, принимаемого от клиента.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID возвращает идентификатор запроса из контекста или пустую строку.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID передаёт идентификатор запроса в контекст и заголовок ответа.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		logging.AddAttrs(r.Context(), slog.String("request_id", id))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID проверяет идентификатор от клиента: он попадает в журнал,
+// поэтому допускаются только буквы, цифры и символы - _ . :
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID создаёт случайный идентификатор запроса из 32 шестнадцатеричных цифр.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// recoverPanic перехватывает панику обработчика, пишет её в журнал со стеком
+// вызовов и отвечает 500. Если ответ уже начал отправляться, соединение
+// обрывается, чтобы клиент не принял неполный ответ за полный.
+func recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := newResponseRecorder(w)
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			logging.FromContext(r.Context()).ErrorContext(r.Context(), "паника при обработке запроса",
+				"method", r.Method, "path", r.URL.Path, "panic", fmt.Sprint(p), "stack", string(debug.Stack()))
+			if rec.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			writeProblem(w, r, Problem{
+				Status: http.StatusInternalServerError,
+				Code:   "internal_error",
+				Detail: "внутренняя ошибка сервера",
+			})
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// responseRecorder запоминает статус и размер ответа, передавая его дальше.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// newResponseRecorder оборачивает w. Если w уже обёрнут, возвращается он сам,
+// чтобы все middleware видели один и тот же статус.
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	if rec, ok := w.(*responseRecorder); ok {
+		return rec
+	}
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap открывает исходный ResponseWriter для http.ResponseController.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,418 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"test-server/internal/app"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// acceptPatch перечисляет форматы тела PATCH для заголовка Accept-Patch.
+var acceptPatch = strings.Join([]string{mergePatchContentType, jsonPatchContentType, "application/json"}, ", ")
+
+var (
+	errInvalidPatch = &app.Error{
+		Kind:    app.KindValidation,
+		Code:    "invalid_patch",
+		Message: "некорректный документ изменений",
+	}
+	errPatchTestFailed = &app.Error{
+		Kind:    app.KindConflict,
+		Code:    "patch_test_failed",
+		Message: "проверка test не прошла",
+	}
+)
+
+// patchOperation — операция JSON Patch (RFC 6902). Value остаётся необработанным,
+// чтобы отличить отсутствующее значение от null.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// shopDocument представляет магазин в том же виде, в каком его принимают POST и PUT:
+// {"shop": {...}, "categories": [id, ...]}. К этому документу применяются изменения.
+func shopDocument(current app.ShopWithCategories) (map[string]interface{}, error) {
+	categoryIDs := make([]int, 0, len(current.Categories))
+	for _, category := range current.Categories {
+		categoryIDs = append(categoryIDs, category.ID)
+	}
+
+	body, err := json.Marshal(ShopRequest{Shop: current.Shop, CategoryIDs: categoryIDs})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при преобразовании магазина в JSON: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("ошибка при разборе документа магазина: %v", err)
+	}
+	return doc, nil
+}
+
+// shopPatchFromDocuments сравнивает исходный и изменённый документы магазина и
+// возвращает только изменившиеся поля. Типы и белый список полей проверяет internal/app.
+func shopPatchFromDocuments(current map[string]interface{}, patched interface{}) (app.ShopPatch, error) {
+	var changes app.ShopPatch
+	var errs []app.FieldError
+
+	doc, ok := patched.(map[string]interface{})
+	if !ok {
+		return changes, errInvalidPatch.With("документ магазина должен быть объектом")
+	}
+	for _, key := range sortedKeys(doc) {
+		if key != "shop" && key != "categories" {
+			errs = append(errs, app.FieldError{Field: key, Code: "unknown_field", Message: "неизвестное поле"})
+		}
+	}
+
+	currentShop := current["shop"].(map[string]interface{})
+	switch shop := doc["shop"].(type) {
+	case map[string]interface{}:
+		changes.Fields = make(map[string]interface{})
+		for field, value := range shop {
+			if old, ok := currentShop[field]; !ok || !reflect.DeepEqual(old, value) {
+				changes.Fields[field] = value
+			}
+		}
+		// Проверяем поля здесь же, чтобы сообщить обо всех ошибках документа сразу
+		errs = append(errs, app.ValidateShopFields(changes.Fields)...)
+		for _, field := range sortedKeys(currentShop) {
+			if _, ok := shop[field]; !ok {
+				errs = append(errs, app.FieldError{Field: field, Code: "required", Message: "поле нельзя удалить"})
+			}
+		}
+	default:
+		errs = append(errs, app.FieldError{Field: "shop", Code: "invalid_type", Message: "ожидается объект"})
+	}
+
+	// Удалённый массив категорий означает, что магазин отвязывается от всех категорий
+	categories, ok := doc["categories"]
+	if !ok || categories == nil {
+		categories = []interface{}{}
+	}
+	if !reflect.DeepEqual(current["categories"], categories) {
+		ids, err := categoryIDList(categories)
+		if err != nil {
+			errs = append(errs, *err)
+		}
+		changes.CategoryIDs = ids
+	}
+
+	if len(errs) > 0 {
+		return app.ShopPatch{}, app.NewValidationError(errs...)
+	}
+	return changes, nil
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// categoryIDList проверяет, что значение — массив целых чисел.
+func categoryIDList(value interface{}) ([]int, *app.FieldError) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, &app.FieldError{Field: "categories", Code: "invalid_type", Message: "ожидается массив идентификаторов категорий"}
+	}
+	ids := make([]int, 0, len(items))
+	for i, item := range items {
+		id, ok := item.(float64)
+		if !ok || id != float64(int(id)) {
+			return nil, &app.FieldError{
+				Field:   "categories",
+				Code:    "invalid_type",
+				Message: fmt.Sprintf("элемент %d не является идентификатором категории: %v", i, item),
+			}
+		}
+		ids = append(ids, int(id))
+	}
+	return ids, nil
+}
+
+// mergePatch применяет JSON Merge Patch (RFC 7396): null удаляет член объекта,
+// объекты сливаются рекурсивно, остальные значения заменяются целиком.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
+
+// applyJSONPatch последовательно применяет операции JSON Patch (RFC 6902) к doc.
+// Если хотя бы одна операция не выполнена, возвращается ошибка, и результат не используется.
+func applyJSONPatch(doc interface{}, operations []patchOperation) (interface{}, error) {
+	for i, operation := range operations {
+		var err error
+		doc, err = applyPatchOperation(doc, operation)
+		if err != nil {
+			appErr := errInvalidPatch
+			errors.As(err, &appErr)
+			return nil, appErr.With("операция %d (%s %s): %v", i, operation.Op, operation.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func applyPatchOperation(doc interface{}, operation patchOperation) (interface{}, error) {
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operation.Op {
+	case "add", "replace", "test":
+		value, err := operationValue(operation)
+		if err != nil {
+			return nil, err
+		}
+		switch operation.Op {
+		case "add":
+			return pointerAdd(doc, path, value)
+		case "replace":
+			return pointerReplace(doc, path, value)
+		default:
+			current, err := pointerGet(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, errPatchTestFailed.With("значение не совпадает")
+			}
+			return doc, nil
+		}
+	case "remove":
+		doc, _, err := pointerRemove(doc, path)
+		return doc, err
+	case "move", "copy":
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if operation.Op == "move" {
+			if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+				return nil, fmt.Errorf("нельзя переместить значение внутрь самого себя")
+			}
+			doc, value, err = pointerRemove(doc, from)
+		} else {
+			value, err = pointerGet(doc, from)
+			if err == nil {
+				value, err = deepCopy(value)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, value)
+	default:
+		return nil, fmt.Errorf("неизвестная операция %q", operation.Op)
+	}
+}
+
+func operationValue(operation patchOperation) (interface{}, error) {
+	if len(operation.Value) == 0 {
+		return nil, fmt.Errorf("не указано значение value")
+	}
+	var value interface{}
+	if err := json.Unmarshal(operation.Value, &value); err != nil {
+		return nil, fmt.Errorf("некорректное значение value: %v", err)
+	}
+	return value, nil
+}
+
+// parsePointer разбирает JSON Pointer (RFC 6901) на токены.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("путь %q должен начинаться с /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// arrayIndex разбирает индекс массива длины length; "-" допустим только для add.
+func arrayIndex(token string, length int, forAdd bool) (int, error) {
+	if forAdd && token == "-" {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("некорректный индекс массива %q", token)
+	}
+	limit := length - 1
+	if forAdd {
+		limit = length
+	}
+	if i > limit {
+		return 0, fmt.Errorf("индекс %d за пределами массива", i)
+	}
+	return i, nil
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("поле %q не найдено", token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("путь %q не существует", token)
+		}
+	}
+	return doc, nil
+}
+
+// pointerUpdate заменяет значение по пути path на результат update(родитель, последний токен)
+// и возвращает изменённый документ. Массивы пересобираются, поэтому изменения
+// поднимаются от листа к корню.
+func pointerUpdate(doc interface{}, path []string, update func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return update(doc, path[0])
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("поле %q не найдено", path[0])
+		}
+		child, err := pointerUpdate(child, path[1:], update)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = child
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(path[0], len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := pointerUpdate(node[i], path[1:], update)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	default:
+		return nil, fmt.Errorf("путь %q не существует", path[0])
+	}
+}
+
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return pointerUpdate(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("путь %q не существует", token)
+		}
+	})
+}
+
+func pointerReplace(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if _, err := pointerGet(doc, path); err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return value, nil
+	}
+	return pointerUpdate(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		default:
+			nodes := parent.([]interface{})
+			i, _ := arrayIndex(token, len(nodes), false)
+			nodes[i] = value
+			return nodes, nil
+		}
+	})
+}
+
+// pointerRemove удаляет значение по пути и возвращает изменённый документ и удалённое значение.
+func pointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	removed, err := pointerGet(doc, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("нельзя удалить весь документ")
+	}
+	doc, err = pointerUpdate(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			delete(node, token)
+			return node, nil
+		default:
+			nodes := parent.([]interface{})
+			i, _ := arrayIndex(token, len(nodes), false)
+			return append(nodes[:i], nodes[i+1:]...), nil
+		}
+	})
+	return doc, removed, err
+}
+
+func deepCopy(value interface{}) (interface{}, error) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var copied interface{}
+	err = json.Unmarshal(body, &copied)
+	return copied, err
+}
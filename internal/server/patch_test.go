@@ -0,0 +1,190 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPatchShop(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		status      int
+		// code — код ошибки; для успешного ответа пуст
+		code string
+		// fields — ожидаемые ошибки полей в виде поле: код
+		fields []string
+		// price и categories — магазин после запроса
+		price      int
+		categories []int
+	}{
+		{
+			name:        "merge patch",
+			contentType: mergePatchContentType,
+			body:        `{"shop":{"price":350}}`,
+			status:      http.StatusOK,
+			price:       350,
+			categories:  []int{1, 2},
+		},
+		{
+			name:       "application/json как merge patch",
+			body:       `{"shop":{"price":350},"categories":[3]}`,
+			status:     http.StatusOK,
+			price:      350,
+			categories: []int{3},
+		},
+		{
+			name:       "null отвязывает все категории",
+			body:       `{"categories":null}`,
+			status:     http.StatusOK,
+			price:      200,
+			categories: []int{},
+		},
+		{
+			name:       "устаревший маршрут",
+			path:       "/api/v1/shops?id=1",
+			body:       `{"categories":[6]}`,
+			status:     http.StatusOK,
+			price:      200,
+			categories: []int{6},
+		},
+		{
+			name:       "неизвестные поля",
+			body:       `{"shop":{"foo":1},"bar":2}`,
+			status:     http.StatusBadRequest,
+			code:       "validation_failed",
+			fields:     []string{"bar: unknown_field", "foo: unknown_field"},
+			price:      200,
+			categories: []int{1, 2},
+		},
+		{
+			name:       "поля вне белого списка и неверные типы",
+			body:       `{"shop":{"id":9,"price":"дёшево","name":"Булочная"}}`,
+			status:     http.StatusBadRequest,
+			code:       "validation_failed",
+			fields:     []string{"id: read_only", "price: invalid_type"},
+			price:      200,
+			categories: []int{1, 2},
+		},
+		{
+			name:       "удаление обязательного поля",
+			body:       `{"shop":{"image":null}}`,
+			status:     http.StatusBadRequest,
+			code:       "validation_failed",
+			fields:     []string{"image: required"},
+			price:      200,
+			categories: []int{1, 2},
+		},
+		{
+			name:       "несуществующая категория",
+			body:       `{"categories":[1,99]}`,
+			status:     http.StatusBadRequest,
+			code:       "validation_failed",
+			fields:     []string{"categories: not_found"},
+			price:      200,
+			categories: []int{1, 2},
+		},
+		{
+			name:        "json patch",
+			contentType: jsonPatchContentType,
+			body:        `[{"op":"test","path":"/shop/name","value":"Пекарня"},{"op":"add","path":"/categories/-","value":3},{"op":"remove","path":"/categories/0"},{"op":"replace","path":"/shop/price","value":777}]`,
+			status:      http.StatusOK,
+			price:       777,
+			categories:  []int{2, 3},
+		},
+		{
+			name:        "test не прошёл",
+			contentType: jsonPatchContentType,
+			body:        `[{"op":"replace","path":"/shop/price","value":777},{"op":"test","path":"/shop/name","value":"Булочная"}]`,
+			status:      http.StatusConflict,
+			code:        "patch_test_failed",
+			price:       200,
+			categories:  []int{1, 2},
+		},
+		{
+			name:        "json patch добавляет неизвестное поле",
+			contentType: jsonPatchContentType,
+			body:        `[{"op":"move","from":"/categories","path":"/extra"}]`,
+			status:      http.StatusBadRequest,
+			code:        "validation_failed",
+			fields:      []string{"extra: unknown_field"},
+			price:       200,
+			categories:  []int{1, 2},
+		},
+		{
+			name:        "индекс за пределами массива",
+			contentType: jsonPatchContentType,
+			body:        `[{"op":"add","path":"/categories/7","value":1}]`,
+			status:      http.StatusBadRequest,
+			code:        "invalid_patch",
+			price:       200,
+			categories:  []int{1, 2},
+		},
+		{
+			name:        "неизвестная операция",
+			contentType: jsonPatchContentType,
+			body:        `[{"op":"increment","path":"/shop/price","value":1}]`,
+			status:      http.StatusBadRequest,
+			code:        "invalid_patch",
+			price:       200,
+			categories:  []int{1, 2},
+		},
+		{
+			name:        "неподдерживаемый тип тела",
+			contentType: "text/plain",
+			body:        `price=1`,
+			status:      http.StatusUnsupportedMediaType,
+			code:        "unsupported_media_type",
+			price:       200,
+			categories:  []int{1, 2},
+		},
+		{
+			name:       "несуществующий магазин",
+			path:       "/api/v1/shops/99",
+			body:       `{}`,
+			status:     http.StatusNotFound,
+			code:       "shop_not_found",
+			price:      200,
+			categories: []int{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, Options{})
+			id := ts.createShop(t, "Пекарня", 200, 1, 2)
+			path := tt.path
+			if path == "" {
+				path = "/api/v1/shops/1"
+			}
+
+			w := ts.do(t, http.MethodPatch, path, tt.contentType, tt.body)
+			if tt.code == "" {
+				if w.Code != tt.status {
+					t.Fatalf("статус %d, ожидается %d: %s", w.Code, tt.status, w.Body)
+				}
+			} else {
+				problem := checkProblem(t, w, tt.status, tt.code)
+				var fields []string
+				for _, e := range problem.Errors {
+					fields = append(fields, e.Field+": "+e.Code)
+				}
+				if !equalStrings(fields, tt.fields) {
+					t.Errorf("ошибки полей %q, ожидаются %q", fields, tt.fields)
+				}
+			}
+			if tt.status == http.StatusUnsupportedMediaType && w.Header().Get("Accept-Patch") != acceptPatch {
+				t.Errorf("Accept-Patch = %q, ожидается %q", w.Header().Get("Accept-Patch"), acceptPatch)
+			}
+
+			shop := ts.shop(t, id)
+			if shop.Shop.Price != tt.price || shop.Shop.Name != "Пекарня" || shop.Shop.Image != "shop.jpg" {
+				t.Errorf("магазин после запроса %+v", shop.Shop)
+			}
+			if got := categoryIDs(shop); !equalInts(got, tt.categories) {
+				t.Errorf("категории %v, ожидаются %v", got, tt.categories)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"test-server/internal/app"
+	"test-server/internal/logging"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem — тело ответа с ошибкой в формате RFC 7807. Code дублирует последнюю
+// часть Type и предназначен для ветвления логики на стороне клиента.
+type Problem struct {
+	Type     string           `json:"type"`
+	Title    string           `json:"title"`
+	Status   int              `json:"status"`
+	Detail   string           `json:"detail,omitempty"`
+	Instance string           `json:"instance,omitempty"`
+	Code     string           `json:"code"`
+	Errors   []app.FieldError `json:"errors,omitempty"`
+}
+
+// statusByKind сопоставляет класс ошибки internal/app с HTTP-статусом.
+var statusByKind = map[app.Kind]int{
+	app.KindNotFound:   http.StatusNotFound,
+	app.KindValidation: http.StatusBadRequest,
+	app.KindConflict:   http.StatusConflict,
+	app.KindForeignKey: http.StatusBadRequest,
+}
+
+// statusClientClosedRequest — нестандартный статус nginx для запроса, клиент
+// которого отключился, не дождавшись ответа. Сам клиент его уже не увидит.
+const statusClientClosedRequest = 499
+
+// writeError отвечает problem+json, выбирая статус по типизированной ошибке
+// из internal/app. Текст нетипизированных ошибок не раскрывается клиенту.
+// Если нетипизированная ошибка вызвана истёкшим сроком запроса, ответ — 504.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var appErr *app.Error
+	if !errors.As(err, &appErr) {
+		switch ctxErr := r.Context().Err(); {
+		case errors.Is(ctxErr, context.DeadlineExceeded):
+			writeProblem(w, r, Problem{
+				Status: http.StatusGatewayTimeout,
+				Code:   "timeout",
+				Detail: "запрос не уложился в отведённое время",
+			})
+			return
+		case errors.Is(ctxErr, context.Canceled):
+			writeProblem(w, r, Problem{
+				Status: statusClientClosedRequest,
+				Title:  "Client Closed Request",
+				Code:   "client_closed_request",
+				Detail: "клиент закрыл соединение",
+			})
+			return
+		}
+		logging.FromContext(r.Context()).ErrorContext(r.Context(), "ошибка при обработке запроса", "error", err)
+		writeProblem(w, r, Problem{
+			Status: http.StatusInternalServerError,
+			Code:   "internal_error",
+			Detail: "внутренняя ошибка сервера",
+		})
+		return
+	}
+
+	writeProblem(w, r, Problem{
+		Status: statusByKind[appErr.Kind],
+		Code:   appErr.Code,
+		Detail: err.Error(),
+		Errors: appErr.Fields,
+	})
+}
+
+// badRequest отвечает 400 на ошибку, обнаруженную ещё до обращения к internal/app.
+func badRequest(w http.ResponseWriter, r *http.Request, code, detail string) {
+	writeProblem(w, r, Problem{Status: http.StatusBadRequest, Code: code, Detail: detail})
+}
+
+// writeProblem заполняет пустые поля problem значениями по умолчанию и отправляет его.
+func writeProblem(w http.ResponseWriter, r *http.Request, problem Problem) {
+	if problem.Status == 0 {
+		problem.Status = http.StatusInternalServerError
+	}
+	if problem.Type == "" {
+		problem.Type = "/problems/" + problem.Code
+	}
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+	if problem.Instance == "" {
+		problem.Instance = r.URL.Path
+	}
+
+	body, err := json.Marshal(problem)
+	if err != nil {
+		logging.FromContext(r.Context()).ErrorContext(r.Context(), "ошибка при преобразовании ответа в JSON", "error", err)
+		body = []byte(`{"type":"/problems/internal_error","title":"Internal Server Error","status":500,"code":"internal_error"}`)
+		problem.Status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	w.Write(body)
+}
+
+// problemFallback заменяет текстовые ответы 404 и 405, которые ServeMux формирует
+// сам для неизвестных путей и методов, на problem+json, сохраняя заголовок Allow.
+func problemFallback(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &fallbackRecorder{header: http.Header{}}
+		mux.ServeHTTP(rec, r)
+
+		switch rec.status {
+		case http.StatusNotFound:
+			writeProblem(w, r, Problem{Status: http.StatusNotFound, Code: "route_not_found", Detail: "маршрут не найден"})
+		case http.StatusMethodNotAllowed:
+			w.Header().Set("Allow", rec.header.Get("Allow"))
+			writeProblem(w, r, Problem{
+				Status: http.StatusMethodNotAllowed,
+				Code:   "method_not_allowed",
+				Detail: fmt.Sprintf("метод %s не поддерживается для %s", r.Method, r.URL.Path),
+			})
+		default:
+			// Например, перенаправление на очищенный путь: передаём ответ как есть
+			for k, v := range rec.header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(rec.status)
+			w.Write(rec.body)
+		}
+	})
+}
+
+// fallbackRecorder запоминает ответ, который ServeMux формирует без наших обработчиков.
+type fallbackRecorder struct {
+	header http.Header
+	status int
+	body   []byte
+}
+
+func (rec *fallbackRecorder) Header() http.Header { return rec.header }
+
+func (rec *fallbackRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *fallbackRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body = append(rec.body, b...)
+	return len(b), nil
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"test-server/internal/app"
+	"testing"
+	"time"
+)
+
+func TestWriteError(t *testing.T) {
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		err    error
+		status int
+		code   string
+		// hidden — текст, который не должен попасть в ответ
+		hidden string
+	}{
+		{"не найдено", context.Background(), app.ErrShopNotFound, http.StatusNotFound, "shop_not_found", ""},
+		{"обёрнутая ошибка", context.Background(), fmt.Errorf("ошибка при удалении: %w", app.ErrCategoryNotFound), http.StatusNotFound, "category_not_found", ""},
+		{"валидация", context.Background(), app.NewValidationError(app.FieldError{Field: "name", Code: "required"}), http.StatusBadRequest, "validation_failed", ""},
+		{"конфликт", context.Background(), app.ErrCategoryExists, http.StatusConflict, "category_exists", ""},
+		{"некорректный id", context.Background(), app.ErrInvalidID, http.StatusBadRequest, "invalid_id", ""},
+		{"внутренняя ошибка", context.Background(), errors.New("pq: password authentication failed"), http.StatusInternalServerError, "internal_error", "password"},
+		{"истёк срок запроса", expired, fmt.Errorf("ошибка при получении магазинов: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, "timeout", "магазинов"},
+		{"клиент отключился", canceled, errors.New("sql: statement is closed"), statusClientClosedRequest, "client_closed_request", "sql"},
+		// Типизированная ошибка важнее истёкшего срока: ответ уже известен
+		{"типизированная ошибка после срока", expired, app.ErrShopNotFound, http.StatusNotFound, "shop_not_found", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/shops/1", nil).WithContext(tt.ctx)
+			w := httptest.NewRecorder()
+			writeError(w, r, tt.err)
+
+			problem := checkProblem(t, w, tt.status, tt.code)
+			if problem.Instance != "/api/v1/shops/1" {
+				t.Errorf("instance = %q", problem.Instance)
+			}
+			if problem.Title == "" {
+				t.Error("title не заполнен")
+			}
+			if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Error("нет заголовка X-Content-Type-Options")
+			}
+			if tt.hidden != "" && strings.Contains(w.Body.String(), tt.hidden) {
+				t.Errorf("ответ раскрывает %q: %s", tt.hidden, w.Body)
+			}
+		})
+	}
+}
+
+func TestProblemFallback(t *testing.T) {
+	ts := newTestServer(t, Options{})
+
+	checkProblem(t, ts.do(t, http.MethodGet, "/api/v1/unknown", "", ""), http.StatusNotFound, "route_not_found")
+
+	w := ts.do(t, http.MethodPost, "/api/v1/shops/1", "", "{}")
+	checkProblem(t, w, http.StatusMethodNotAllowed, "method_not_allowed")
+	if allow := w.Header().Get("Allow"); allow != "DELETE, GET, HEAD, OPTIONS, PATCH, PUT" {
+		t.Errorf("Allow = %q", allow)
+	}
+
+	checkProblem(t, ts.do(t, http.MethodPost, "/api/v1/shops", "", `{"shop":`), http.StatusBadRequest, "invalid_json")
+}
+
+func TestRouteTimeout(t *testing.T) {
+	// Срок маршрута заменяет общий срок, а его истечение превращается в 504
+	srv := New(app.NewMemoryStore(), Options{
+		RequestTimeout: time.Minute,
+		RouteTimeouts:  map[string]time.Duration{"/api/v1/shops/{id}": time.Millisecond},
+	})
+	var remaining time.Duration
+	mux := http.NewServeMux()
+	handleResource(mux, "/api/v1/shops/{id}", srv.routeTimeout("/api/v1/shops/{id}"), map[string]http.HandlerFunc{
+		http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			deadline, _ := r.Context().Deadline()
+			remaining = time.Until(deadline)
+			<-r.Context().Done()
+			writeError(w, r, fmt.Errorf("ошибка при получении магазина: %w", r.Context().Err()))
+		},
+	})
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/shops/1", nil))
+	checkProblem(t, w, http.StatusGatewayTimeout, "timeout")
+	if remaining > time.Millisecond {
+		t.Errorf("до истечения срока %s, ожидается не больше 1ms", remaining)
+	}
+	if srv.routeTimeout("/api/v1/categories") != time.Minute {
+		t.Errorf("срок остальных маршрутов %s, ожидается общий", srv.routeTimeout("/api/v1/categories"))
+	}
+}
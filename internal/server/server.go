@@ -1,36 +1,293 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
 	"test-server/internal/app"
+	"test-server/internal/logging"
+	"time"
 )
 
 type Server struct {
 	http.Server
-	App *app.App
+	App app.Store
+	// corsOrigins — источники, которым разрешены запросы из браузера
+	corsOrigins     []string
+	shutdownTimeout time.Duration
+	requestTimeout  time.Duration
+	routeTimeouts   map[string]time.Duration
+	accessLog       io.Writer
+	accessLogFormat string
+	logger          *slog.Logger
+	logLevel        *slog.LevelVar
+	adminToken      string
 }
 
-func New(serviceApp *app.App) *Server {
+// Options — настройки HTTP-сервера.
+type Options struct {
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout — сколько ждать завершения обрабатываемых запросов при остановке
+	ShutdownTimeout time.Duration
+	// RequestTimeout — срок обработки запроса; по его истечении запрос к базе
+	// данных отменяется, а клиент получает 504. 0 — без срока
+	RequestTimeout time.Duration
+	// RouteTimeouts — сроки для отдельных маршрутов вместо RequestTimeout,
+	// ключ — шаблон пути, например /api/v1/categories/{id}
+	RouteTimeouts map[string]time.Duration
+	// CORSOrigins — источники вида https://example.com, "*" разрешает любой;
+	// пустой список отключает CORS
+	CORSOrigins []string
+	// AccessLogFormat — формат журнала запросов: AccessLogCLF, AccessLogJSON
+	// или AccessLogOff; пустое значение означает AccessLogCLF
+	AccessLogFormat string
+	// AccessLog — куда писать журнал запросов; nil — os.Stdout
+	AccessLog io.Writer
+	// Logger — журнал сервера; nil — slog.Default()
+	Logger *slog.Logger
+	// LogLevel — уровень журнала, который можно менять через /admin/log-level
+	LogLevel *slog.LevelVar
+	// AdminToken — токен доступа к маршрутам /admin/; пустой отключает их
+	AdminToken string
+}
+
+func New(serviceApp app.Store, opts Options) *Server {
 	var srv Server
-	srv.Addr = ":8080"
+	srv.Addr = opts.Addr
+	srv.ReadTimeout = opts.ReadTimeout
+	srv.ReadHeaderTimeout = opts.ReadHeaderTimeout
+	srv.WriteTimeout = opts.WriteTimeout
+	srv.IdleTimeout = opts.IdleTimeout
 	srv.App = serviceApp
+	srv.corsOrigins = opts.CORSOrigins
+	srv.shutdownTimeout = opts.ShutdownTimeout
+	srv.requestTimeout = opts.RequestTimeout
+	srv.routeTimeouts = opts.RouteTimeouts
+	srv.accessLog = opts.AccessLog
+	if srv.accessLog == nil {
+		srv.accessLog = os.Stdout
+	}
+	srv.accessLogFormat = opts.AccessLogFormat
+	if srv.accessLogFormat == "" {
+		srv.accessLogFormat = AccessLogCLF
+	}
+	srv.logger = opts.Logger
+	if srv.logger == nil {
+		srv.logger = slog.Default()
+	}
+	srv.logLevel = opts.LogLevel
+	srv.adminToken = opts.AdminToken
 	return &srv
 }
 
-func (s *Server) Run() {
-	fmt.Println("Сервер запущен")
+// Run обслуживает запросы, пока не будет отменён ctx. После отмены сервер
+// перестаёт принимать новые соединения и ждёт завершения обрабатываемых запросов
+// не дольше shutdownTimeout, после чего закрывает оставшиеся соединения.
+func (s *Server) Run(ctx context.Context) error {
 	s.Handler = s.InitRoutes()
-	if err := s.ListenAndServe(); err != nil {
-		fmt.Println(err.Error())
+
+	// Порт занимается до сообщения о запуске: если адрес занят, сервер сразу
+	// сообщает об ошибке, а в журнал попадает настоящий адрес, в том числе при порте 0
+	addr := s.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("ошибка при запуске сервера: %v", err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Serve(ln)
+	}()
+	s.logger.Info("сервер запущен", "addr", ln.Addr().String())
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("ошибка работы сервера: %v", err)
+	case <-ctx.Done():
 	}
 
+	s.logger.Info("остановка сервера: ожидание завершения запросов", "timeout", s.shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		s.Close()
+		return fmt.Errorf("не все запросы завершились за %s: %v", s.shutdownTimeout, err)
+	}
+	s.logger.Info("сервер остановлен")
+	return nil
 }
 
+// InitRoutes регистрирует маршруты API и оборачивает их в общие middleware:
+// журнал сервера, идентификатор запроса, журнал запросов, перехват паник и CORS.
 func (s *Server) InitRoutes() http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/api/v1/shops", s.HandlerShops)
-	mux.HandleFunc("/api/v1/categories", s.HandlerCategories)
-	mux.HandleFunc("/api/v1/shop_categories", s.HandlerShopCategories)
-	return mux
+	registered := make(map[string]bool)
+	route := func(path string, handlers map[string]http.HandlerFunc) {
+		handleResource(mux, path, s.routeTimeout(path), handlers)
+		registered[path] = true
+	}
+
+	route("/api/v1/shops", map[string]http.HandlerFunc{
+		http.MethodGet:  s.GetHandlerShops,
+		http.MethodPost: s.PostHandlerShops,
+		// Устаревшие маршруты с параметром ?id=, оставлены для совместимости
+		http.MethodPut:    deprecated(s.PutHandlerShops),
+		http.MethodPatch:  deprecated(s.PatchHandlerShops),
+		http.MethodDelete: deprecated(s.DeleteHandlerShops),
+	})
+	route("/api/v1/shops/suggest", map[string]http.HandlerFunc{
+		http.MethodGet: s.GetHandlerSuggest,
+	})
+	route("/api/v1/shops/{id}", map[string]http.HandlerFunc{
+		http.MethodGet:    s.GetHandlerShop,
+		http.MethodPut:    s.PutHandlerShops,
+		http.MethodPatch:  s.PatchHandlerShops,
+		http.MethodDelete: s.DeleteHandlerShops,
+	})
+	route("/api/v1/shops/{id}/categories", map[string]http.HandlerFunc{
+		http.MethodGet: s.GetHandlerShopCategoryList,
+	})
+	route("/api/v1/shops/{id}/categories/{categoryID}", map[string]http.HandlerFunc{
+		http.MethodPut:    s.PutHandlerShopCategory,
+		http.MethodDelete: s.DeleteHandlerShopCategory,
+	})
+
+	route("/api/v1/categories", map[string]http.HandlerFunc{
+		http.MethodGet:  s.GetHandlerCategories,
+		http.MethodPost: s.PostHandlerCategories,
+	})
+	route("/api/v1/categories/tree", map[string]http.HandlerFunc{
+		http.MethodGet: s.GetHandlerCategoryTree,
+	})
+	route("/api/v1/categories/stats", map[string]http.HandlerFunc{
+		http.MethodGet: s.GetHandlerCategoryStats,
+	})
+	route("/api/v1/categories/{id}", map[string]http.HandlerFunc{
+		http.MethodGet:    s.GetHandlerCategory,
+		http.MethodPut:    s.UpdateHandlerCategory,
+		http.MethodPatch:  s.UpdateHandlerCategory,
+		http.MethodDelete: s.DeleteHandlerCategory,
+	})
+	route("/api/v1/categories/{id}/shops", map[string]http.HandlerFunc{
+		http.MethodGet: s.GetHandlerCategoryShops,
+	})
+	route("/api/v1/categories/{id}/breadcrumbs", map[string]http.HandlerFunc{
+		http.MethodGet: s.GetHandlerCategoryBreadcrumbs,
+	})
+
+	route("/api/v1/shop_categories", map[string]http.HandlerFunc{
+		http.MethodGet: s.HandlerShopCategories,
+	})
+
+	if s.adminToken != "" && s.logLevel != nil {
+		route("/admin/log-level", map[string]http.HandlerFunc{
+			http.MethodGet: s.requireAdmin(s.GetHandlerLogLevel),
+			http.MethodPut: s.requireAdmin(s.PutHandlerLogLevel),
+		})
+	}
+
+	for path := range s.routeTimeouts {
+		if !registered[path] {
+			s.logger.Warn("срок задан для неизвестного маршрута", "route", path)
+		}
+	}
+	return chain(problemFallback(mux),
+		withLogger(s.logger),
+		withRequestID,
+		accessLog(s.accessLog, s.accessLogFormat),
+		recoverPanic,
+		cors(s.corsOrigins),
+	)
+}
+
+// routeTimeout возвращает срок обработки запросов к маршруту path.
+func (s *Server) routeTimeout(path string) time.Duration {
+	if timeout, ok := s.routeTimeouts[path]; ok {
+		return timeout
+	}
+	return s.requestTimeout
+}
+
+// handleResource регистрирует обработчики методов для одного пути и ответ на OPTIONS.
+// На остальные методы ServeMux сам отвечает 405 с заголовком Allow, а GET
+// автоматически обслуживает и HEAD. Запросы получают срок обработки timeout.
+func handleResource(mux *http.ServeMux, path string, timeout time.Duration, handlers map[string]http.HandlerFunc) {
+	allowed := []string{http.MethodOptions}
+	for method, handler := range handlers {
+		pattern := method + " " + path
+		mux.HandleFunc(pattern, withRoute(pattern, withTimeout(timeout, handler)))
+		allowed = append(allowed, method)
+		if method == http.MethodGet {
+			allowed = append(allowed, http.MethodHead)
+		}
+	}
+	sort.Strings(allowed)
+	allow := strings.Join(allowed, ", ")
+
+	mux.HandleFunc(http.MethodOptions+" "+path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// withTimeout ограничивает контекст запроса сроком timeout. Запросы к базе данных
+// выполняются с этим контекстом и отменяются по его истечении; ответ 504
+// формирует writeError. Нулевой timeout оставляет запрос без срока.
+func withTimeout(timeout time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	if timeout <= 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// withRoute добавляет в журнал запроса шаблон маршрута pattern
+// и идентификаторы магазина и категории из пути.
+func withRoute(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	// {id} в путях /api/v1/categories/... — категория, в остальных — магазин
+	idKey := "shop_id"
+	if strings.Contains(pattern, "/api/v1/categories/") {
+		idKey = "category_id"
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		attrs := []slog.Attr{slog.String("route", pattern)}
+		if id := r.PathValue("id"); id != "" {
+			attrs = append(attrs, slog.String(idKey, id))
+		}
+		if id := r.PathValue("categoryID"); id != "" {
+			attrs = append(attrs, slog.String("category_id", id))
+		}
+		logging.AddAttrs(r.Context(), attrs...)
+		next(w, r)
+	}
+}
+
+// deprecated помечает ответ устаревшего маршрута заголовком Deprecation
+// и указывает в Link путь, которым его следует заменить.
+func deprecated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		if id := r.URL.Query().Get("id"); id != "" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/%s>; rel="successor-version"`, r.URL.Path, url.PathEscape(id)))
+			logging.AddAttrs(r.Context(), slog.String("shop_id", id))
+		}
+		next(w, r)
+	}
 }
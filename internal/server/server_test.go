@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"test-server/internal/app"
+	"testing"
+)
+
+// testServer обслуживает запросы обработчиками сервера поверх MemoryStore
+// с категориями 1–6 из InsertSampleCategories.
+type testServer struct {
+	handler http.Handler
+}
+
+func newTestServer(t *testing.T, opts Options) *testServer {
+	t.Helper()
+	store := app.NewMemoryStore()
+	store.InsertSampleCategories()
+	opts.AccessLogFormat = AccessLogOff
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return &testServer{handler: New(store, opts).InitRoutes()}
+}
+
+// do выполняет запрос method к path; пустой contentType означает JSON.
+func (ts *testServer) do(t *testing.T, method, path, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, r)
+	return w
+}
+
+// createShop добавляет магазин и возвращает его id из заголовка Location.
+func (ts *testServer) createShop(t *testing.T, name string, price int, categories ...int) int {
+	t.Helper()
+	body, err := json.Marshal(ShopRequest{
+		Shop:        app.Shop{Name: name, Image: "shop.jpg", Price: price, Description: "Описание: " + name},
+		CategoryIDs: categories,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := ts.do(t, http.MethodPost, "/api/v1/shops", "", string(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("создание магазина %q: статус %d: %s", name, w.Code, w.Body)
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(w.Header().Get("Location"), "/api/v1/shops/"))
+	if err != nil {
+		t.Fatalf("некорректный Location %q", w.Header().Get("Location"))
+	}
+	return id
+}
+
+// shop возвращает магазин id вместе с категориями.
+func (ts *testServer) shop(t *testing.T, id int) app.ShopWithCategories {
+	t.Helper()
+	var shop app.ShopWithCategories
+	decodeResponse(t, ts.do(t, http.MethodGet, fmt.Sprintf("/api/v1/shops/%d", id), "", ""), http.StatusOK, &shop)
+	return shop
+}
+
+// decodeResponse проверяет статус ответа и декодирует его тело в v.
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder, status int, v interface{}) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("статус %d, ожидается %d: %s", w.Code, status, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("ошибка декодирования ответа %q: %v", w.Body, err)
+	}
+}
+
+// checkProblem проверяет, что ответ — problem+json со статусом status и кодом code.
+func checkProblem(t *testing.T, w *httptest.ResponseRecorder, status int, code string) Problem {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != problemContentType {
+		t.Errorf("Content-Type = %q, ожидается %q", ct, problemContentType)
+	}
+	var problem Problem
+	decodeResponse(t, w, status, &problem)
+	if problem.Code != code || problem.Status != status || problem.Type != "/problems/"+code {
+		t.Errorf("получено code=%q status=%d type=%q, ожидается code=%q status=%d", problem.Code, problem.Status, problem.Type, code, status)
+	}
+	return problem
+}
+
+// categoryIDs возвращает идентификаторы категорий магазина.
+func categoryIDs(shop app.ShopWithCategories) []int {
+	ids := []int{}
+	for _, category := range shop.Categories {
+		ids = append(ids, category.ID)
+	}
+	return ids
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -8,18 +8,16 @@ import (
 
 func (s *Server) HandlerShopCategories(w http.ResponseWriter, r *http.Request) {
 	// Получаем связи между магазинами и категориями
-	shopCategories, err := s.App.GetShopCategories()
+	shopCategories, err := s.App.GetShopCategories(r.Context())
 	if err != nil {
-		fmt.Println(err.Error())
-		http.Error(w, "Ошибка при получении категорий магазинов: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return // Не забываем выходить из функции при ошибке
 	}
 
 	// Преобразуем shopCategories в JSON
 	respjson, err := json.Marshal(shopCategories)
 	if err != nil {
-		fmt.Println(err.Error())
-		http.Error(w, "Ошибка при преобразовании данных в JSON: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("ошибка при преобразовании данных в JSON: %v", err))
 		return // Не забываем выходить из функции при ошибке
 	}
 
@@ -28,3 +26,54 @@ func (s *Server) HandlerShopCategories(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)                       // Устанавливаем статус 200 OK
 	w.Write(respjson)                                  // Отправляем данные клиенту
 }
+
+func (s *Server) GetHandlerShopCategoryList(w http.ResponseWriter, r *http.Request) {
+	shopID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	categories, err := s.App.GetCategoriesByShopID(r.Context(), shopID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, categories)
+}
+
+func (s *Server) PutHandlerShopCategory(w http.ResponseWriter, r *http.Request) {
+	shopID, categoryID, ok := shopCategoryParams(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.App.LinkShopCategory(r.Context(), shopID, categoryID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) DeleteHandlerShopCategory(w http.ResponseWriter, r *http.Request) {
+	shopID, categoryID, ok := shopCategoryParams(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.App.UnlinkShopCategory(r.Context(), shopID, categoryID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// shopCategoryParams разбирает id магазина и категории из пути и при ошибке сам отвечает 400.
+func shopCategoryParams(w http.ResponseWriter, r *http.Request) (shopID, categoryID int, ok bool) {
+	if shopID, ok = pathID(w, r, "id"); !ok {
+		return 0, 0, false
+	}
+	if categoryID, ok = pathID(w, r, "categoryID"); !ok {
+		return 0, 0, false
+	}
+	return shopID, categoryID, true
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestShopCategoryLinks(t *testing.T) {
+	ts := newTestServer(t, Options{})
+	shopID := ts.createShop(t, "Пекарня", 200, 1)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		code   string
+		want   []int
+	}{
+		{"привязка", http.MethodPut, "/api/v1/shops/1/categories/2", http.StatusNoContent, "", []int{1, 2}},
+		{"повторная привязка", http.MethodPut, "/api/v1/shops/1/categories/2", http.StatusNoContent, "", []int{1, 2}},
+		{"несуществующая категория", http.MethodPut, "/api/v1/shops/1/categories/99", http.StatusNotFound, "category_not_found", []int{1, 2}},
+		{"несуществующий магазин", http.MethodPut, "/api/v1/shops/99/categories/1", http.StatusNotFound, "shop_not_found", []int{1, 2}},
+		{"некорректный id", http.MethodPut, "/api/v1/shops/1/categories/x", http.StatusBadRequest, "invalid_id", []int{1, 2}},
+		{"отвязка", http.MethodDelete, "/api/v1/shops/1/categories/1", http.StatusNoContent, "", []int{2}},
+		{"отвязка несуществующей связи", http.MethodDelete, "/api/v1/shops/1/categories/1", http.StatusNotFound, "shop_category_not_found", []int{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := ts.do(t, tt.method, tt.path, "", "")
+			if tt.code != "" {
+				checkProblem(t, w, tt.status, tt.code)
+			} else if w.Code != tt.status {
+				t.Fatalf("статус %d, ожидается %d: %s", w.Code, tt.status, w.Body)
+			}
+			if got := categoryIDs(ts.shop(t, shopID)); !equalInts(got, tt.want) {
+				t.Errorf("категории магазина %v, ожидаются %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteShopLinks(t *testing.T) {
+	// Удаление магазина удаляет его связи, не затрагивая остальные
+	ts := newTestServer(t, Options{})
+	bakery := ts.createShop(t, "Пекарня", 200, 1, 2)
+	books := ts.createShop(t, "Книжный", 500, 2, 3)
+
+	if w := ts.do(t, http.MethodDelete, "/api/v1/shops/"+strconv.Itoa(bakery), "", ""); w.Code != http.StatusOK {
+		t.Fatalf("удаление магазина: статус %d: %s", w.Code, w.Body)
+	}
+	var links []struct {
+		ShopID     int `json:"shop_id"`
+		CategoryID int `json:"category_id"`
+	}
+	decodeResponse(t, ts.do(t, http.MethodGet, "/api/v1/shop_categories", "", ""), http.StatusOK, &links)
+	if len(links) != 2 || links[0].ShopID != books || links[1].ShopID != books {
+		t.Errorf("связи после удаления %+v, ожидаются только связи книжного", links)
+	}
+	checkProblem(t, ts.do(t, http.MethodGet, "/api/v1/shops/"+strconv.Itoa(bakery)+"/categories", "", ""), http.StatusNotFound, "shop_not_found")
+}
@@ -1,12 +1,12 @@
 package server
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 	"test-server/internal/app"
 )
 
@@ -15,143 +15,291 @@ type ShopRequest struct {
 	CategoryIDs []int    `json:"categories"`
 }
 
-func (s *Server) HandlerShops(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		s.GetHandlerShops(w, r)
-	case http.MethodPost:
-		s.PostHandlerShops(w, r)
-	case http.MethodPut:
-		s.PutHandlerShops(w, r)
-	case http.MethodDelete:
-		s.DeleteHandlerShops(w, r)
-	case http.MethodPatch:
-		s.PatchHandlerShops(w, r)
-	default:
-		http.Error(w, "Метод не доступен", http.StatusMethodNotAllowed)
-	}
+// ShopListResponse — страница магазинов и, если они запрошены параметром
+// facets=true, фасеты по категориям и ценам.
+type ShopListResponse struct {
+	app.Page[app.ShopWithCategories]
+	Facets *app.ShopFacets `json:"facets,omitempty"`
+}
 
+// shopIDParam возвращает id магазина из пути /api/v1/shops/{id}, а для
+// устаревших маршрутов — из параметра ?id=.
+func shopIDParam(r *http.Request) string {
+	if id := r.PathValue("id"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("id")
 }
 
 func (s *Server) GetHandlerShops(w http.ResponseWriter, r *http.Request) {
-	// Получаем параметры page, limit и category_id из запроса
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-	categoryID := r.URL.Query().Get("category_id")
+	// Пакетное получение магазинов по списку id, например ?ids=1,2,3
+	if r.URL.Query().Has("ids") {
+		s.getHandlerShopsByIDs(w, r)
+		return
+	}
 
-	// Устанавливаем значения по умолчанию
-	page := 1
-	limit := 10
+	list, err := parseShopListRequest(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.writeShopList(w, r, list)
+}
 
-	// Преобразуем page и limit в целые числа
+// shopListRequest — разобранные параметры запроса списка магазинов.
+type shopListRequest struct {
+	params app.ShopListParams
+	// query — строка полнотекстового поиска; пустая — обычный список
+	query      string
+	withFacets bool
+	buckets    []int
+}
 
-	p, err := strconv.Atoi(pageStr)
-	if err == nil && p > 0 {
-		page = p
+// parseShopListRequest разбирает параметры page, limit, cursor, q, отбора
+// по категориям и цене, sort, facets и price_buckets.
+func parseShopListRequest(r *http.Request) (shopListRequest, error) {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		return shopListRequest{}, err
+	}
+
+	// Курсор имеет приоритет над номером страницы: offset при нём не используется
+	list := shopListRequest{
+		params: app.ShopListParams{
+			Limit:  limit,
+			Offset: offset,
+			Cursor: r.URL.Query().Get("cursor"),
+		},
+		query: strings.TrimSpace(r.URL.Query().Get("q")),
 	}
+	params := &list.params
 
-	l, err := strconv.Atoi(limitStr)
-	if err == nil && l > 0 {
-		limit = l
+	// Отбор по категориям: category_id=1,2,3, match=any|all, exclude_category_id=4,5
+	// и include_descendants=true, чтобы учитывать магазины подкатегорий
+	params.Categories.Match = app.CategoryMatch(r.URL.Query().Get("match"))
+	if params.Categories.IDs, err = parseIDList(r.URL.Query().Get("category_id")); err != nil {
+		return shopListRequest{}, err
+	}
+	if params.Categories.Exclude, err = parseIDList(r.URL.Query().Get("exclude_category_id")); err != nil {
+		return shopListRequest{}, err
 	}
 
-	// Рассчитываем offset для SQL-запроса
-	offset := (page - 1) * limit
+	// Фильтр по цене и сортировка проверяются вместе, чтобы вернуть все ошибки сразу
+	var errs []app.FieldError
+	params.MinPrice = priceParam(r, "min_price", &errs)
+	params.MaxPrice = priceParam(r, "max_price", &errs)
+	params.Categories.Descendants = boolParam(r, "include_descendants", &errs)
+	if sortStr := r.URL.Query().Get("sort"); sortStr != "" {
+		var sortErrs []app.FieldError
+		params.Sort, sortErrs = app.ParseShopSort(sortStr)
+		errs = append(errs, sortErrs...)
+	}
+	list.withFacets = boolParam(r, "facets", &errs)
+	if r.URL.Query().Get("price_buckets") != "" {
+		list.buckets = intListParam(r, "price_buckets", &errs)
+	}
+	if len(errs) > 0 {
+		return shopListRequest{}, app.NewValidationError(errs...)
+	}
+	return list, nil
+}
 
-	var shops []app.Shop
-	var shopWithCategories []app.ShopWithCategories
+// writeShopList отвечает страницей магазинов по разобранному запросу, а если
+// запрошены фасеты — и фасетами по тем же условиям.
+func (s *Server) writeShopList(w http.ResponseWriter, r *http.Request, list shopListRequest) {
+	var result ShopListResponse
+	var err error
+	if list.query != "" {
+		// Полнотекстовый поиск с теми же фильтрами, что и у списка
+		result.Page, err = s.App.SearchShops(r.Context(), app.ShopSearchParams{Query: list.query, ShopListParams: list.params})
+	} else {
+		result.Page, err = s.App.GetShops(r.Context(), list.params)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	// Если categoryID не пустой, используем фильтрацию по категории
-	if categoryID != "" {
-		shops, err = s.App.GetShopsByCategoryID(categoryID, limit, offset)
+	if list.withFacets {
+		facets, err := s.App.GetShopFacets(r.Context(), app.FacetParams{Query: list.query, ShopListParams: list.params, PriceBuckets: list.buckets})
 		if err != nil {
-			fmt.Println(err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
+		result.Facets = &facets
+	}
 
-		// Отправляем результат в формате JSON
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(shops)
-	} else {
-		// Если categoryID пустой, получаем все магазины
-		shopWithCategories, err = s.App.GetShops(limit, offset)
+	// Отправляем результат в формате JSON
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// pageParams разбирает параметры page и limit и возвращает лимит и смещение страницы.
+// Некорректные значения заменяются значениями по умолчанию, а лимит больше
+// app.MaxPageLimit уменьшается до него.
+func pageParams(r *http.Request) (limit, offset int, err error) {
+	page := 1
+	limit = app.DefaultPageLimit
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, app.MaxPageLimit)
+	}
+	offset, err = app.PageOffset(page, limit)
+	return limit, offset, err
+}
+
+// priceParam разбирает необязательную цену из параметра запроса name.
+func priceParam(r *http.Request, name string, errs *[]app.FieldError) *int {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil
+	}
+	price, err := strconv.Atoi(value)
+	if err != nil {
+		*errs = append(*errs, app.FieldError{
+			Field:   name,
+			Code:    "invalid_type",
+			Message: fmt.Sprintf("ожидается целое число, получено %q", value),
+		})
+		return nil
+	}
+	return &price
+}
+
+// boolParam разбирает необязательный логический параметр запроса name.
+func boolParam(r *http.Request, name string, errs *[]app.FieldError) bool {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		*errs = append(*errs, app.FieldError{
+			Field:   name,
+			Code:    "invalid_type",
+			Message: fmt.Sprintf("ожидается true или false, получено %q", value),
+		})
+	}
+	return b
+}
+
+// intListParam разбирает список целых чисел через запятую из параметра запроса name.
+func intListParam(r *http.Request, name string, errs *[]app.FieldError) []int {
+	list := []int{}
+	for _, part := range strings.Split(r.URL.Query().Get(name), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
 		if err != nil {
-			fmt.Println(err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			*errs = append(*errs, app.FieldError{
+				Field:   name,
+				Code:    "invalid_type",
+				Message: fmt.Sprintf("ожидается целое число, получено %q", part),
+			})
+			return nil
 		}
+		list = append(list, n)
+	}
+	return list
+}
 
-		// Отправляем результат в формате JSON
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(shopWithCategories)
+func (s *Server) getHandlerShopsByIDs(w http.ResponseWriter, r *http.Request) {
+	ids, err := parseIDList(r.URL.Query().Get("ids"))
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
+	shops, err := s.App.GetShopsByIDs(r.Context(), ids)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, app.Page[app.ShopWithCategories]{Items: shops, Total: len(shops)})
 }
 
-func (s *Server) PostHandlerShops(w http.ResponseWriter, r *http.Request) {
-	// Структура для обработки данных запроса
+// parseIDList разбирает список идентификаторов через запятую.
+func parseIDList(list string) ([]int, error) {
+	var ids []int
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q", app.ErrInvalidID, part)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
 
-	var reqBody ShopRequest
-	var shopData app.Shop
+// GetHandlerSuggest возвращает подсказки для поля поиска: названия магазинов
+// и категорий, слова которых начинаются с ?prefix=, с учётом опечаток.
+func (s *Server) GetHandlerSuggest(w http.ResponseWriter, r *http.Request) {
+	limit := app.DefaultSuggestLimit
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, app.MaxSuggestLimit)
+	}
 
-	// Чтение и сохранение тела запроса в переменной для многократного использования
-	bodyBytes, err := io.ReadAll(r.Body)
+	suggestions, err := s.App.Suggest(r.Context(), r.URL.Query().Get("prefix"), limit)
 	if err != nil {
-		fmt.Println("Ошибка чтения тела запроса:", err.Error())
-		http.Error(w, "Ошибка чтения тела запроса", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
-	// Восстанавливаем тело запроса для повторного использования
-	r.Body.Close()
-	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	writeJSON(w, r, http.StatusOK, app.Page[app.Suggestion]{Items: suggestions, Total: len(suggestions)})
+}
 
-	// Попытка декодировать JSON как ShopRequest
-	err = json.Unmarshal(bodyBytes, &reqBody)
-	if err != nil || reqBody.Shop.Name == "" {
-		// Если ошибка декодирования или имя магазина пустое, пробуем декодировать как app.Shop
-		if err := json.Unmarshal(bodyBytes, &shopData); err != nil {
-			fmt.Println("Ошибка декодирования JSON:", err.Error())
-			http.Error(w, "Ошибка декодирования JSON", http.StatusBadRequest)
-			return
-		}
-		reqBody.Shop = shopData // Присваиваем декодированные данные в reqBody.Shop
+func (s *Server) GetHandlerShop(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
 	}
 
-	// Сохраняем магазин в базу данных
-	shopID, err := s.App.CreateNewShop(reqBody.Shop)
+	shop, err := s.App.GetShopByID(r.Context(), id)
 	if err != nil {
-		fmt.Println("Ошибка при добавлении магазина:", err.Error())
-		http.Error(w, "Ошибка при добавлении магазина", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
+	writeJSON(w, r, http.StatusOK, shop)
+}
 
-	// Добавляем связи между магазином и категориями
-	if len(reqBody.CategoryIDs) > 0 {
-		if err := s.App.AddShopCategories(shopID, reqBody.CategoryIDs); err != nil {
-			fmt.Println("Ошибка при добавлении категорий:", err.Error())
-			http.Error(w, "Ошибка при добавлении категорий", http.StatusInternalServerError)
-			return
-		}
+func (s *Server) PostHandlerShops(w http.ResponseWriter, r *http.Request) {
+	// Тело запроса должно иметь вид {"shop": {...}, "categories": [...]}
+	var reqBody ShopRequest
+	if !decodeJSON(w, r, &reqBody) {
+		return
 	}
 
+	// Сохраняем магазин вместе со связями с категориями
+	shopID, err := s.App.CreateShop(r.Context(), reqBody.Shop, reqBody.CategoryIDs)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/shops/%d", shopID))
 	fmt.Fprintln(w, "Магазин успешно добавлен!")
 }
 
 func (s *Server) DeleteHandlerShops(w http.ResponseWriter, r *http.Request) {
-	// Получаем параметр id из URL
-	query := r.URL.Query()
-	id := query.Get("id")
+	// Получаем id из пути или из параметра URL
+	id := shopIDParam(r)
 
 	if id == "" {
-		http.Error(w, "ID не указан", http.StatusBadRequest)
+		badRequest(w, r, "missing_id", "ID магазина не указан")
 		return
 	}
 
 	// Вызываем метод для удаления магазина
-	err := s.App.DeleteShopByID(id)
+	err := s.App.DeleteShopByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Ошибка при удалении магазина: %v", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -162,35 +310,24 @@ func (s *Server) DeleteHandlerShops(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) PutHandlerShops(w http.ResponseWriter, r *http.Request) {
-	// Получаем параметр id из URL
-	query := r.URL.Query()
-	id := query.Get("id")
+	// Получаем id из пути или из параметра URL
+	id := shopIDParam(r)
 
 	if id == "" {
-		http.Error(w, "ID не указан", http.StatusBadRequest)
+		badRequest(w, r, "missing_id", "ID магазина не указан")
 		return
 	}
 
 	// Декодируем тело запроса в структуру ShopUpdateRequest
 	var request ShopRequest
-	err := json.NewDecoder(r.Body).Decode(&request)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Ошибка декодирования данных: %v", err), http.StatusBadRequest)
-		return
-	}
-
-	// Обновляем магазин в базе данных
-	err = s.App.UpdateShopByID(id, request.Shop)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Ошибка при обновлении магазина: %v", err), http.StatusInternalServerError)
+	if !decodeJSON(w, r, &request) {
 		return
 	}
 
-	// Обновляем категории магазина, если они указаны
-
-	err = s.App.UpdateShopCategories(id, request.CategoryIDs)
+	// Обновляем магазин и его категории вместе
+	err := s.App.ReplaceShop(r.Context(), id, request.Shop, request.CategoryIDs)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Ошибка при обновлении категорий: %v", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -198,47 +335,74 @@ func (s *Server) PutHandlerShops(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Магазин и категории успешно обновлены"))
 }
+
+// PatchHandlerShops принимает изменения в формате JSON Merge Patch (RFC 7396)
+// или JSON Patch (RFC 6902). Изменения применяются к документу магазина
+// {"shop": {...}, "categories": [...]}; тело с типом application/json
+// обрабатывается как merge patch, как и раньше.
 func (s *Server) PatchHandlerShops(w http.ResponseWriter, r *http.Request) {
-	// Получаем `id` магазина из URL-параметров
-	query := r.URL.Query()
-	id := query.Get("id")
+	// Получаем `id` магазина из пути или из параметра URL
+	id := shopIDParam(r)
 	if id == "" {
-		http.Error(w, "ID магазина не указан", http.StatusBadRequest)
+		badRequest(w, r, "missing_id", "ID магазина не указан")
 		return
 	}
-
-	// Декодируем тело запроса
-	var reqBody map[string]interface{}
-	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	shopID, err := strconv.Atoi(id)
 	if err != nil {
-		http.Error(w, "Ошибка декодирования данных: "+err.Error(), http.StatusBadRequest)
+		writeError(w, r, app.ErrInvalidID.With("некорректный идентификатор %q", id))
 		return
 	}
 
-	// Обновляем поля магазина, если они присутствуют
-	if shopFields, ok := reqBody["shop"].(map[string]interface{}); ok {
-		err = s.App.UpdateShopFields(id, shopFields)
-		if err != nil {
-			http.Error(w, "Ошибка обновления данных магазина: "+err.Error(), http.StatusInternalServerError)
+	// Выбираем способ применения изменений по типу тела запроса
+	var apply func(doc interface{}) (interface{}, error)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "", "application/json", mergePatchContentType:
+		var patch interface{}
+		if !decodeJSON(w, r, &patch) {
+			return
+		}
+		apply = func(doc interface{}) (interface{}, error) {
+			return mergePatch(doc, patch), nil
+		}
+	case jsonPatchContentType:
+		// RFC 6902 требует игнорировать неизвестные члены операций
+		var operations []patchOperation
+		if !decodeBody(w, r, &operations, false) {
 			return
 		}
+		apply = func(doc interface{}) (interface{}, error) {
+			return applyJSONPatch(doc, operations)
+		}
+	default:
+		w.Header().Set("Accept-Patch", acceptPatch)
+		writeProblem(w, r, Problem{
+			Status: http.StatusUnsupportedMediaType,
+			Code:   "unsupported_media_type",
+			Detail: fmt.Sprintf("тип тела %q не поддерживается, ожидается один из: %s", mediaType, acceptPatch),
+		})
+		return
 	}
 
-	// Обновляем категории, если они присутствуют
-	if categoryIDs, ok := reqBody["categories"].([]interface{}); ok {
-		// Преобразуем интерфейсы в слайс целых чисел
-		var categories []int
-		for _, categoryID := range categoryIDs {
-			if idFloat, ok := categoryID.(float64); ok {
-				categories = append(categories, int(idFloat)) // Преобразуем float64 в int
-			}
+	// Изменения вычисляются по текущему состоянию магазина внутри транзакции
+	err = s.App.ApplyShopPatch(r.Context(), shopID, func(current app.ShopWithCategories) (app.ShopPatch, error) {
+		doc, err := shopDocument(current)
+		if err != nil {
+			return app.ShopPatch{}, err
 		}
-
-		err = s.App.UpdateShopCategories(id, categories)
+		original, err := shopDocument(current)
 		if err != nil {
-			http.Error(w, "Ошибка обновления категорий магазина: "+err.Error(), http.StatusInternalServerError)
-			return
+			return app.ShopPatch{}, err
+		}
+		patched, err := apply(doc)
+		if err != nil {
+			return app.ShopPatch{}, err
 		}
+		return shopPatchFromDocuments(original, patched)
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
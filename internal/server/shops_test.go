@@ -0,0 +1,389 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"test-server/internal/app"
+	"testing"
+)
+
+// newShopListServer создаёт семь магазинов с повторяющимися ценами и названиями,
+// чтобы порядок внутри равных значений определял только id.
+func newShopListServer(t *testing.T) *testServer {
+	ts := newTestServer(t, Options{})
+	for _, shop := range []struct {
+		name  string
+		price int
+	}{
+		{"Альфа", 300},  // 1
+		{"Бета", 100},   // 2
+		{"Гамма", 300},  // 3
+		{"Дельта", 200}, // 4
+		{"Альфа", 300},  // 5
+		{"Бета", 100},   // 6
+		{"Гамма", 200},  // 7
+	} {
+		ts.createShop(t, shop.name, shop.price)
+	}
+	return ts
+}
+
+// shopPage запрашивает страницу магазинов с параметрами query.
+func (ts *testServer) shopPage(t *testing.T, query url.Values) app.Page[app.ShopWithCategories] {
+	t.Helper()
+	var page app.Page[app.ShopWithCategories]
+	decodeResponse(t, ts.do(t, http.MethodGet, "/api/v1/shops?"+query.Encode(), "", ""), http.StatusOK, &page)
+	return page
+}
+
+// walkShops проходит все страницы по курсорам и возвращает id магазинов по порядку.
+func (ts *testServer) walkShops(t *testing.T, query url.Values) []int {
+	t.Helper()
+	ids := []int{}
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatalf("курсоры не заканчиваются, получено %v", ids)
+		}
+		page := ts.shopPage(t, query)
+		ids = append(ids, shopIDs(page)...)
+		if page.NextCursor == "" {
+			return ids
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+}
+
+func shopIDs(page app.Page[app.ShopWithCategories]) []int {
+	ids := []int{}
+	for _, item := range page.Items {
+		ids = append(ids, item.Shop.ID)
+	}
+	return ids
+}
+
+func TestShopsCursor(t *testing.T) {
+	ts := newShopListServer(t)
+	for _, limit := range []int{1, 2, 3, 7, 10} {
+		t.Run(fmt.Sprintf("limit=%d", limit), func(t *testing.T) {
+			// Проход по курсорам даёт тот же порядок, что и одна страница
+			got := ts.walkShops(t, url.Values{"limit": {fmt.Sprint(limit)}})
+			if want := []int{1, 2, 3, 4, 5, 6, 7}; !equalInts(got, want) {
+				t.Errorf("порядок %v, ожидается %v", got, want)
+			}
+		})
+	}
+
+	page := ts.shopPage(t, url.Values{"limit": {"3"}})
+	if page.Total != 7 || page.NextCursor == "" {
+		t.Errorf("total = %d, next_cursor = %q", page.Total, page.NextCursor)
+	}
+}
+
+func TestShopsSortCursor(t *testing.T) {
+	tests := []struct {
+		sort string
+		want []int
+	}{
+		{"-id", []int{7, 6, 5, 4, 3, 2, 1}},
+		{"price", []int{2, 6, 4, 7, 1, 3, 5}},
+		{"-price", []int{1, 3, 5, 4, 7, 2, 6}},
+		{"price,-name", []int{2, 6, 4, 7, 3, 1, 5}},
+		{"-name", []int{4, 3, 7, 2, 6, 1, 5}},
+		{"name,-id", []int{5, 1, 6, 2, 7, 3, 4}},
+	}
+	ts := newShopListServer(t)
+	for _, tt := range tests {
+		for _, limit := range []int{1, 2, 3, 7} {
+			t.Run(fmt.Sprintf("%s/limit=%d", tt.sort, limit), func(t *testing.T) {
+				// Равные значения упорядочены по id, поэтому курсор не теряет
+				// и не повторяет магазины на границе страниц
+				got := ts.walkShops(t, url.Values{"sort": {tt.sort}, "limit": {fmt.Sprint(limit)}})
+				if !equalInts(got, tt.want) {
+					t.Errorf("порядок %v, ожидается %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestShopsPriceFilter(t *testing.T) {
+	ts := newShopListServer(t)
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"min_price=200", []int{1, 3, 4, 5, 7}},
+		{"max_price=200", []int{2, 4, 6, 7}},
+		{"min_price=200&max_price=200", []int{4, 7}},
+		{"min_price=1000", []int{}},
+		{"min_price=100&sort=-price&limit=2", []int{1, 3, 5, 4, 7, 2, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ts.walkShops(t, query); !equalInts(got, tt.want) {
+				t.Errorf("магазины %v, ожидаются %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShopsCursorAfterDelete(t *testing.T) {
+	// В отличие от номера страницы, курсор не сдвигается при удалении уже
+	// показанного магазина
+	ts := newShopListServer(t)
+	first := ts.shopPage(t, url.Values{"limit": {"3"}})
+	if got := shopIDs(first); !equalInts(got, []int{1, 2, 3}) {
+		t.Fatalf("первая страница %v", got)
+	}
+	if w := ts.do(t, http.MethodDelete, "/api/v1/shops/2", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("удаление магазина: статус %d: %s", w.Code, w.Body)
+	}
+	second := ts.shopPage(t, url.Values{"limit": {"3"}, "cursor": {first.NextCursor}})
+	if got := shopIDs(second); !equalInts(got, []int{4, 5, 6}) {
+		t.Errorf("вторая страница %v, ожидается [4 5 6]", got)
+	}
+	if second.Total != 6 {
+		t.Errorf("total = %d, ожидается 6", second.Total)
+	}
+}
+
+func TestShopsInvalidParams(t *testing.T) {
+	ts := newShopListServer(t)
+	cursor := ts.shopPage(t, url.Values{"sort": {"price"}, "limit": {"2"}}).NextCursor
+
+	tests := []struct {
+		name   string
+		path   string
+		code   string
+		fields []string
+	}{
+		{"испорченный курсор", "/api/v1/shops?cursor=!!!", "invalid_cursor", nil},
+		{"курсор не из base64 JSON", "/api/v1/shops?cursor=" + url.QueryEscape("bm90IGpzb24"), "invalid_cursor", nil},
+		{"курсор другой сортировки", "/api/v1/shops?sort=-price&cursor=" + url.QueryEscape(cursor), "invalid_cursor", nil},
+		{"курсор без сортировки", "/api/v1/shops?cursor=" + url.QueryEscape(cursor), "invalid_cursor", nil},
+		{"неизвестное поле сортировки", "/api/v1/shops?sort=price,rating", "validation_failed", []string{"sort: invalid_sort"}},
+		{"повторное поле сортировки", "/api/v1/shops?sort=price,-price", "validation_failed", []string{"sort: invalid_sort"}},
+		{"rank без поиска", "/api/v1/shops?sort=-rank", "validation_failed", []string{"sort: invalid_sort"}},
+		{"некорректная цена", "/api/v1/shops?min_price=дёшево&max_price=1.5", "validation_failed", []string{"min_price: invalid_type", "max_price: invalid_type"}},
+		{"границы цены наоборот", "/api/v1/shops?min_price=300&max_price=100", "validation_failed", []string{"min_price: invalid_range"}},
+		{"все ошибки сразу", "/api/v1/shops?sort=foo&min_price=x", "validation_failed", []string{"min_price: invalid_type", "sort: invalid_sort"}},
+		{"переполнение страницы", fmt.Sprintf("/api/v1/shops?page=%d&limit=100", math.MaxInt32), "validation_failed", []string{"page: out_of_range"}},
+		{"переполнение страницы категорий", fmt.Sprintf("/api/v1/categories?page=%d&limit=100", math.MaxInt32), "validation_failed", []string{"page: out_of_range"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem := checkProblem(t, ts.do(t, http.MethodGet, tt.path, "", ""), http.StatusBadRequest, tt.code)
+			var fields []string
+			for _, e := range problem.Errors {
+				fields = append(fields, e.Field+": "+e.Code)
+			}
+			if !equalStrings(fields, tt.fields) {
+				t.Errorf("ошибки полей %q, ожидаются %q", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestShopsPageLimit(t *testing.T) {
+	ts := newTestServer(t, Options{})
+	for i := 0; i < app.MaxPageLimit+5; i++ {
+		ts.createShop(t, fmt.Sprintf("Магазин %d", i), 100)
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", app.DefaultPageLimit},
+		{"limit=0", app.DefaultPageLimit},
+		{"limit=abc", app.DefaultPageLimit},
+		{"limit=20", 20},
+		{"limit=1000", app.MaxPageLimit},
+		{fmt.Sprintf("limit=%d", math.MaxInt64), app.MaxPageLimit},
+		{"limit=100&page=2", 5},
+		{"limit=100&page=3", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var page app.Page[app.ShopWithCategories]
+			decodeResponse(t, ts.do(t, http.MethodGet, "/api/v1/shops?"+tt.query, "", ""), http.StatusOK, &page)
+			if len(page.Items) != tt.want {
+				t.Errorf("на странице %d магазинов, ожидается %d", len(page.Items), tt.want)
+			}
+			if page.Total != app.MaxPageLimit+5 {
+				t.Errorf("total = %d", page.Total)
+			}
+		})
+	}
+}
+
+func TestCreateShopValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		fields []string
+	}{
+		{"несуществующая категория", `{"shop":{"name":"Пекарня","image":"a.jpg","price":200},"categories":[1,99]}`, []string{"categories: not_found"}},
+		{"повторная категория", `{"shop":{"name":"Пекарня","image":"a.jpg","price":200},"categories":[1,1]}`, []string{"categories: duplicate"}},
+		{"все ошибки сразу", `{"shop":{"name":"","image":"/a.jpg","price":-1},"categories":[99]}`, []string{"name: required", "image: invalid_format", "price: out_of_range", "categories: not_found"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, Options{})
+			problem := checkProblem(t, ts.do(t, http.MethodPost, "/api/v1/shops", "", tt.body), http.StatusBadRequest, "validation_failed")
+			var fields []string
+			for _, e := range problem.Errors {
+				fields = append(fields, e.Field+": "+e.Code)
+			}
+			if !equalStrings(fields, tt.fields) {
+				t.Errorf("ошибки полей %q, ожидаются %q", fields, tt.fields)
+			}
+
+			// Магазин не создан, связей нет
+			var links []struct{}
+			decodeResponse(t, ts.do(t, http.MethodGet, "/api/v1/shop_categories", "", ""), http.StatusOK, &links)
+			if len(links) != 0 {
+				t.Errorf("осталось %d связей", len(links))
+			}
+			checkProblem(t, ts.do(t, http.MethodGet, "/api/v1/shops/1", "", ""), http.StatusNotFound, "shop_not_found")
+		})
+	}
+}
+
+func TestShopWhitespace(t *testing.T) {
+	// Пробелы по краям не считаются в длине названия и не сохраняются
+	ts := newTestServer(t, Options{})
+	long := strings.Repeat("я", app.MaxShopNameLength)
+	body := `{"shop":{"name":"   ` + long + `   ","image":" a.jpg ","price":200,"description":"  Хлеб  "}}`
+	if w := ts.do(t, http.MethodPost, "/api/v1/shops", "", body); w.Code != http.StatusOK {
+		t.Fatalf("создание магазина: статус %d: %s", w.Code, w.Body)
+	}
+	if shop := ts.shop(t, 1).Shop; shop.Name != long || shop.Image != "a.jpg" || shop.Description != "Хлеб" {
+		t.Errorf("сохранено name=%q image=%q description=%q", shop.Name, shop.Image, shop.Description)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   string
+	}{
+		{"замена", http.MethodPut, `{"shop":{"name":"  Пекарня  ","image":"a.jpg","price":200}}`, "Пекарня"},
+		{"частичное изменение", http.MethodPatch, `{"shop":{"name":"  Булочная  "}}`, "Булочная"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := ts.do(t, tt.method, "/api/v1/shops/1", "", tt.body); w.Code != http.StatusOK {
+				t.Fatalf("статус %d: %s", w.Code, w.Body)
+			}
+			if got := ts.shop(t, 1).Shop.Name; got != tt.want {
+				t.Errorf("название %q, ожидается %q", got, tt.want)
+			}
+		})
+	}
+
+	problem := checkProblem(t, ts.do(t, http.MethodPatch, "/api/v1/shops/1", "", `{"shop":{"name":"   "}}`), http.StatusBadRequest, "validation_failed")
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "name" || problem.Errors[0].Code != "required" {
+		t.Errorf("ошибки полей %+v, ожидается name: required", problem.Errors)
+	}
+}
+
+func TestShopsSearch(t *testing.T) {
+	ts := newTestServer(t, Options{})
+	ts.createShop(t, "Книжный магазин Буква", 500)
+	ts.createShop(t, "Пекарня", 200)
+	ts.createShop(t, "Магазин цветов", 1000)
+	ts.createShop(t, "Аптека 24", 300)
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"магазин", []int{1, 3}},
+		{"магазины", []int{1, 3}},
+		{"МАГАЗИН", []int{1, 3}},
+		{"Буква магазин", []int{1}},
+		{"цветы", []int{3}},
+		// Транслитерация и другая раскладка
+		{"magazin", []int{1, 3}},
+		{"magaziny", []int{1, 3}},
+		{"vfufpby", []int{1, 3}},
+		{"pekarnya", []int{2}},
+		{"Bukva magazin", []int{1}},
+		// Опечатки
+		{"магизин", []int{1, 3}},
+		{"пкеарня", []int{2}},
+		{"электроника", []int{}},
+		// Слова без латинской формы
+		{"24", []int{4}},
+		{"ъ", []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			page := ts.shopPage(t, url.Values{"q": {tt.query}, "sort": {"id"}})
+			if got := shopIDs(page); !equalInts(got, tt.want) {
+				t.Errorf("найдены магазины %v, ожидаются %v", got, tt.want)
+			}
+			if page.Total != len(tt.want) {
+				t.Errorf("total = %d, ожидается %d", page.Total, len(tt.want))
+			}
+		})
+	}
+
+	// Подсветка приходит вместе с результатами поиска
+	page := ts.shopPage(t, url.Values{"q": {"цветы"}})
+	if len(page.Items) != 1 || page.Items[0].Highlight == nil || page.Items[0].Highlight.Name != "Магазин <mark>цветов</mark>" {
+		t.Errorf("подсветка %+v", page.Items)
+	}
+
+	// Разметка из названия не попадает в подсветку
+	ts.createShop(t, `<img src=x onerror=alert(1)> Лавка`, 100)
+	page = ts.shopPage(t, url.Values{"q": {"лавка"}})
+	if len(page.Items) != 1 || page.Items[0].Highlight == nil || page.Items[0].Highlight.Name != "&lt;img src=x onerror=alert(1)&gt; <mark>Лавка</mark>" {
+		t.Errorf("подсветка %+v", page.Items)
+	}
+}
+
+func TestShopsSuggest(t *testing.T) {
+	ts := newTestServer(t, Options{})
+	ts.createShop(t, "Книжный магазин Буква", 500)
+	ts.createShop(t, "Пекарня", 200)
+	ts.createShop(t, "Магазин цветов", 1000)
+
+	tests := []struct {
+		prefix string
+		limit  string
+		want   []app.Suggestion
+	}{
+		{"маг", "", []app.Suggestion{{Type: "shop", ID: 3, Name: "Магазин цветов"}, {Type: "shop", ID: 1, Name: "Книжный магазин Буква"}}},
+		{"маг", "1", []app.Suggestion{{Type: "shop", ID: 3, Name: "Магазин цветов"}}},
+		{"пекр", "", []app.Suggestion{{Type: "shop", ID: 2, Name: "Пекарня"}}},
+		{"катег", "2", []app.Suggestion{{Type: "category", ID: 1, Name: "Категория 1"}, {Type: "category", ID: 2, Name: "Категория 2"}}},
+		{"", "", []app.Suggestion{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix+"/"+tt.limit, func(t *testing.T) {
+			query := url.Values{"prefix": {tt.prefix}}
+			if tt.limit != "" {
+				query.Set("limit", tt.limit)
+			}
+			var page app.Page[app.Suggestion]
+			decodeResponse(t, ts.do(t, http.MethodGet, "/api/v1/shops/suggest?"+query.Encode(), "", ""), http.StatusOK, &page)
+			if len(page.Items) != len(tt.want) {
+				t.Fatalf("подсказки %+v, ожидаются %+v", page.Items, tt.want)
+			}
+			for i := range page.Items {
+				if page.Items[i] != tt.want[i] {
+					t.Errorf("подсказка %d: %+v, ожидается %+v", i, page.Items[i], tt.want[i])
+				}
+			}
+		})
+	}
+}